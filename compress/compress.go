@@ -92,6 +92,12 @@ func compressFilesInDirectory(params *CompressParams) error {
 		} else {
 			fmt.Printf("+ creating %v.gz\n", path)
 		}
+		err = CompressWithZstdToFile(content, path+".zst")
+		if err != nil {
+			return err
+		} else {
+			fmt.Printf("+ creating %v.zst\n", path)
+		}
 
 		return nil
 	})
@@ -107,7 +113,7 @@ func compressFilesInDirectory(params *CompressParams) error {
 
 func isCompressedFile(path string) bool {
 	extension := filepath.Ext(path)
-	return extension == ".gz" || extension == ".br"
+	return extension == ".gz" || extension == ".br" || extension == ".zst"
 }
 
 func isUnicodeFile(path string) bool {
@@ -56,11 +56,13 @@ func assertCompression(t *testing.T, workingDirectory string, threshold int64) e
 		} else if info.Size() >= threshold && isUnicodeFile(path) {
 			content, err := os.ReadFile(path)
 			test.AssertNoError(t, err)
-			for _, v := range []string{path + ".gz", path + ".br"} {
+			for _, v := range []string{path + ".gz", path + ".br", path + ".zst"} {
 				test.AssertTrue(t, fileExists(v))
 				var compressedContent []byte
 				if strings.HasSuffix(v, ".br") {
 					compressedContent = test.DecompressBrotliFile(v)
+				} else if strings.HasSuffix(v, ".zst") {
+					compressedContent = test.DecompressZstdFile(v)
 				} else {
 					compressedContent = test.DecompressGzipFile(v)
 				}
@@ -7,8 +7,13 @@ import (
 	"os"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
+// Browsers only need to support windows of up to 8MB for the zstd content
+// encoding (RFC 9659).
+const zstdWindowSize = 8 << 20
+
 func CompressWithBrotliToFile(content []byte, file string) error {
 	compressedContent := CompressWithBrotliBest(content)
 	return os.WriteFile(file, compressedContent, 0644)
@@ -46,6 +51,25 @@ func CompressWithGzipFast(content []byte) []byte {
 	})
 }
 
+func CompressWithZstdToFile(content []byte, file string) error {
+	compressedContent := CompressWithZstdBest(content)
+	return os.WriteFile(file, compressedContent, 0644)
+}
+
+func CompressWithZstdBest(content []byte) []byte {
+	return compress(content, func(buffer *bytes.Buffer) io.WriteCloser {
+		writer, _ := zstd.NewWriter(buffer, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithWindowSize(zstdWindowSize))
+		return writer
+	})
+}
+
+func CompressWithZstdFast(content []byte) []byte {
+	return compress(content, func(buffer *bytes.Buffer) io.WriteCloser {
+		writer, _ := zstd.NewWriter(buffer, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithWindowSize(zstdWindowSize), zstd.WithEncoderConcurrency(1))
+		return writer
+	})
+}
+
 func compress(content []byte, compression func(buffer *bytes.Buffer) io.WriteCloser) []byte {
 	var buffer bytes.Buffer
 	writer := compression(&buffer)
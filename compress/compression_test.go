@@ -42,3 +42,21 @@ func TestCompressionGzipFast(t *testing.T) {
 	content = test.DecompressGzip(content)
 	test.AssertEqual(t, string(content), expected)
 }
+
+func TestCompressionZstd(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file.txt.zst")
+	expected := strings.Repeat("example", 10)
+	CompressWithZstdToFile([]byte(expected), filePath)
+
+	content := test.DecompressZstdFile(filePath)
+	test.AssertEqual(t, string(content), expected)
+}
+
+func TestCompressionZstdFast(t *testing.T) {
+	expected := strings.Repeat("example", 10)
+	content := CompressWithZstdFast([]byte(expected))
+
+	content = test.DecompressZstd(content)
+	test.AssertEqual(t, string(content), expected)
+}
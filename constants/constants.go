@@ -1,9 +1,16 @@
 package constants
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 const DefaultCompressionThreshold = int64(1024)
 const DefaultCacheSize = 1024 * 1024
+const DefaultCacheMaxFileSize = 256 * 1024
+const DefaultWatchDebounce = 250 * time.Millisecond
+const DefaultWatchInterval = 2 * time.Second
+const DefaultShutdownTimeout = 20 * time.Second
 
 var CspTemplate string = strings.Join([]string{
 	"default-src 'self' ${_CSP_STYLE_SRC};",
@@ -1,17 +1,19 @@
 module ngstaticserver
 
-go 1.21
+go 1.22
 
 require (
 	github.com/dimfeld/httptreemux/v5 v5.5.0
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/hashicorp/go-envparse v0.1.0
+	github.com/klauspost/compress v1.18.0
 	golang.org/x/net v0.18.0
 )
 
 require (
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
 	golang.org/x/sys v0.14.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
 
 require (
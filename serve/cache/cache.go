@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AssetCache is a least recently used cache for file contents, bounded by
+// the total amount of bytes held in memory. Entries are keyed by path, so
+// precompressed variants (e.g. main.js.br) are cached independently.
+type AssetCache struct {
+	maxSize     int64
+	maxFileSize int64
+	mutex       sync.Mutex
+	size        int64
+	entries     map[string]*list.Element
+	order       *list.List
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+}
+
+type cacheEntry struct {
+	path    string
+	modTime time.Time
+	content []byte
+}
+
+func NewAssetCache(maxSize int64, maxFileSize int64) *AssetCache {
+	if maxFileSize > maxSize {
+		maxFileSize = maxSize
+	}
+	return &AssetCache{
+		maxSize:     maxSize,
+		maxFileSize: maxFileSize,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// Open returns the content of the file at the given path. Files that fit into
+// the cache are served from memory as long as their modification time and
+// size have not changed. A nil or disabled cache always reads from disk.
+func (cache *AssetCache) Open(path string) (io.ReadSeekCloser, error) {
+	if cache == nil || cache.maxSize <= 0 {
+		return os.Open(path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	} else if info.Size() > cache.maxFileSize {
+		return os.Open(path)
+	}
+
+	if content, ok := cache.lookup(path, info); ok {
+		hits := cache.hits.Add(1)
+		slog.Debug("Asset cache hit", "path", path, "hits", hits, "misses", cache.misses.Load())
+		return nopCloser{bytes.NewReader(content)}, nil
+	}
+
+	misses := cache.misses.Add(1)
+	slog.Debug("Asset cache miss", "path", path, "hits", cache.hits.Load(), "misses", misses)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cache.store(path, info.ModTime(), content)
+	return nopCloser{bytes.NewReader(content)}, nil
+}
+
+// lookup returns the cached content, if the file was not changed. As files
+// may be replaced while preserving their modification time (e.g. cp -p or
+// rsync --times), the size is compared as well.
+func (cache *AssetCache) lookup(path string, info os.FileInfo) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[path]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !entry.modTime.Equal(info.ModTime()) || int64(len(entry.content)) != info.Size() {
+		cache.remove(element)
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+	return entry.content, true
+}
+
+func (cache *AssetCache) store(path string, modTime time.Time, content []byte) {
+	size := int64(len(content))
+	if size > cache.maxFileSize {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[path]; ok {
+		cache.remove(element)
+	}
+	for cache.size+size > cache.maxSize {
+		oldest := cache.order.Back()
+		if oldest == nil {
+			break
+		}
+		slog.Debug("Asset cache eviction", "path", oldest.Value.(*cacheEntry).path)
+		cache.remove(oldest)
+	}
+
+	cache.entries[path] = cache.order.PushFront(&cacheEntry{path, modTime, content})
+	cache.size += size
+}
+
+func (cache *AssetCache) remove(element *list.Element) {
+	entry := cache.order.Remove(element).(*cacheEntry)
+	delete(cache.entries, entry.path)
+	cache.size -= int64(len(entry.content))
+}
+
+// Size returns the amount of bytes currently held in memory.
+func (cache *AssetCache) Size() int64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.size
+}
+
+func (cache *AssetCache) Hits() uint64 {
+	return cache.hits.Load()
+}
+
+func (cache *AssetCache) Misses() uint64 {
+	return cache.misses.Load()
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
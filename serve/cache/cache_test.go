@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"io"
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile("main.js", "console.log('main')")
+	assetCache := NewAssetCache(1024, 1024)
+
+	test.AssertEqual(t, readAll(t, assetCache, filepath.Join(context.Path, "main.js")), "console.log('main')")
+	test.AssertEqual(t, readAll(t, assetCache, filepath.Join(context.Path, "main.js")), "console.log('main')")
+	test.AssertEqual(t, assetCache.Misses(), uint64(1))
+	test.AssertEqual(t, assetCache.Hits(), uint64(1))
+	test.AssertEqual(t, assetCache.Size(), int64(len("console.log('main')")))
+}
+
+func TestOpenInvalidatesByModTime(t *testing.T) {
+	context := test.NewTestDir(t)
+	path := filepath.Join(context.Path, "main.js")
+	context.WriteFile("main.js", "old")
+	assetCache := NewAssetCache(1024, 1024)
+	test.AssertEqual(t, readAll(t, assetCache, path), "old")
+
+	context.WriteFile("main.js", "new")
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+
+	test.AssertEqual(t, readAll(t, assetCache, path), "new")
+	test.AssertEqual(t, assetCache.Misses(), uint64(2))
+	test.AssertEqual(t, assetCache.Hits(), uint64(0))
+}
+
+func TestOpenInvalidatesBySize(t *testing.T) {
+	context := test.NewTestDir(t)
+	path := filepath.Join(context.Path, "main.js")
+	context.WriteFile("main.js", "old")
+	modTime := time.Now().Add(-time.Hour)
+	test.AssertNoError(t, os.Chtimes(path, modTime, modTime))
+	assetCache := NewAssetCache(1024, 1024)
+	test.AssertEqual(t, readAll(t, assetCache, path), "old")
+
+	// The file is replaced with its modification time preserved.
+	context.WriteFile("main.js", "newer")
+	test.AssertNoError(t, os.Chtimes(path, modTime, modTime))
+
+	test.AssertEqual(t, readAll(t, assetCache, path), "newer")
+	test.AssertEqual(t, assetCache.Misses(), uint64(2))
+	test.AssertEqual(t, assetCache.Hits(), uint64(0))
+}
+
+func TestOpenEvictsLeastRecentlyUsed(t *testing.T) {
+	context := test.NewTestDir(t)
+	for _, name := range []string{"a.js", "b.js", "c.js"} {
+		context.WriteFile(name, strings.Repeat(name[:1], 40))
+	}
+	assetCache := NewAssetCache(100, 100)
+
+	readAll(t, assetCache, filepath.Join(context.Path, "a.js"))
+	readAll(t, assetCache, filepath.Join(context.Path, "b.js"))
+	readAll(t, assetCache, filepath.Join(context.Path, "a.js"))
+	readAll(t, assetCache, filepath.Join(context.Path, "c.js"))
+
+	test.AssertEqual(t, assetCache.Size(), int64(80))
+	_, hasA := assetCache.entries[filepath.Join(context.Path, "a.js")]
+	_, hasB := assetCache.entries[filepath.Join(context.Path, "b.js")]
+	test.AssertTrue(t, hasA)
+	test.AssertTrue(t, !hasB)
+}
+
+func TestOpenSkipsLargeFiles(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile("large.js", strings.Repeat("x", 200))
+	assetCache := NewAssetCache(1024, 100)
+
+	test.AssertEqual(t, readAll(t, assetCache, filepath.Join(context.Path, "large.js")), strings.Repeat("x", 200))
+	test.AssertEqual(t, assetCache.Size(), int64(0))
+}
+
+func TestOpenWithoutCache(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile("main.js", "main")
+	var assetCache *AssetCache
+
+	test.AssertEqual(t, readAll(t, assetCache, filepath.Join(context.Path, "main.js")), "main")
+	_, err := assetCache.Open(filepath.Join(context.Path, "missing.js"))
+	test.AssertTrue(t, os.IsNotExist(err))
+}
+
+func readAll(t *testing.T, assetCache *AssetCache, path string) string {
+	t.Helper()
+	f, err := assetCache.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	test.AssertNoError(t, err)
+	return string(content)
+}
@@ -4,90 +4,133 @@ import (
 	"crypto/sha512"
 	"encoding/json"
 	"fmt"
-	"log/slog"
+	"maps"
 	"os"
-	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// AppVariables contains the configuration of the app and its variables. The
+// variables are published as immutable snapshots, so that requests can read
+// them while a file watcher merges changes.
 type AppVariables struct {
-	Variant                       string
-	EnvironmentVariables          []string
-	LastChangedAt                 time.Time
-	populatedEnvironmentVariables map[string]*string
-}
-
-// ngsscJSON corresponds to the relevant JSON structure of ngssc.json
-type ngsscJSON struct {
 	Variant              string
 	EnvironmentVariables []string
+	// Dir is the directory of the ngssc.json, if the configuration was read from one.
+	Dir string
+	// FilePattern selects the HTML files relative to Dir, into which the
+	// variables are inserted.
+	FilePattern string
+	// Public restricts the variables of the .env files, if there is no
+	// ngssc.json. If nil, the variables are not restricted.
+	Public *PublicVariables
+	state  atomic.Pointer[variablesState]
+	// mutex serializes the writers, readers use the current state.
+	mutex sync.Mutex
 }
 
-func DefaultAppVariables() *AppVariables {
-	return &AppVariables{
-		Variant:                       "global",
-		EnvironmentVariables:          make([]string, 0),
-		LastChangedAt:                 time.Now(),
-		populatedEnvironmentVariables: make(map[string]*string),
-	}
+type variablesState struct {
+	variables     map[string]*string
+	lastChangedAt time.Time
 }
 
-func InitializeAppVariables(root string) *AppVariables {
-	path := filepath.Join(root, "ngssc.json")
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return DefaultAppVariables()
-	}
-
-	slog.Info(fmt.Sprintf("Detected ngssc.json file at %v. Reading configuration.", path))
-	var ngssc *ngsscJSON
-	err = json.Unmarshal(data, &ngssc)
-	if err != nil {
-		err = fmt.Errorf("failed to parse %v\n%v", path, err)
-	} else if ngssc == nil {
-		err = fmt.Errorf("invalid ngssc.json at %v (Must not be empty)", path)
-	} else if ngssc.EnvironmentVariables == nil {
-		err = fmt.Errorf("invalid ngssc.json at %v (environmentVariables must be defined)", path)
-	} else if ngssc.Variant != "process" && ngssc.Variant != "global" && ngssc.Variant != "NG_ENV" {
-		err = fmt.Errorf("invalid ngssc.json at %v (variant must either be process, NG_ENV or global)", path)
-	}
+// Snapshot is the state of the app variables at a point in time. Its
+// variables must not be modified.
+type Snapshot struct {
+	Variant       string
+	Variables     map[string]*string
+	LastChangedAt time.Time
+}
 
-	if err != nil {
-		slog.Warn(fmt.Sprintf("%v, creating default configuration", err))
-		return DefaultAppVariables()
-	}
+func DefaultAppVariables() *AppVariables {
+	return newAppVariables("global", make([]string, 0), make(map[string]*string))
+}
 
-	return &AppVariables{
-		Variant:                       ngssc.Variant,
-		EnvironmentVariables:          ngssc.EnvironmentVariables,
-		LastChangedAt:                 time.Now(),
-		populatedEnvironmentVariables: populateEnvironmentVariables(ngssc.EnvironmentVariables),
-	}
+func newAppVariables(variant string, environmentVariables []string, variables map[string]*string) *AppVariables {
+	appVariables := &AppVariables{Variant: variant, EnvironmentVariables: environmentVariables}
+	appVariables.state.Store(&variablesState{variables, time.Now()})
+	return appVariables
 }
 
-func populateEnvironmentVariables(environmentVariables []string) map[string]*string {
+// populateEnvironmentVariables resolves the entries of environmentVariables
+// with the given variables (e.g. from the .env file) or the process
+// environment. A name is always contained (nil if undefined), while a pattern
+// (see compileVariablePattern) results in the currently matching variables.
+func populateEnvironmentVariables(environmentVariables []string, variables map[string]*string) map[string]*string {
 	envMap := make(map[string]*string)
-	for _, env := range environmentVariables {
-		value, exists := os.LookupEnv(env)
-		if exists {
-			envMap[env] = &value
+	lookup := func(name string) {
+		if value, ok := variables[name]; ok {
+			envMap[name] = value
+		} else if value, ok := os.LookupEnv(name); ok {
+			envMap[name] = &value
 		} else {
-			envMap[env] = nil
+			envMap[name] = nil
+		}
+	}
+	for _, entry := range environmentVariables {
+		pattern, _ := compileVariablePattern(entry)
+		if pattern == nil {
+			lookup(entry)
+			continue
+		}
+		for _, env := range os.Environ() {
+			if name, _, _ := strings.Cut(env, "="); pattern.MatchString(name) {
+				lookup(name)
+			}
+		}
+		for name := range variables {
+			if pattern.MatchString(name) {
+				lookup(name)
+			}
 		}
 	}
 
 	return envMap
 }
 
-func (ngsscConfig AppVariables) Insert(htmlBytes []byte, calculateCspHash bool) ([]byte, string) {
-	jsonBytes, _ := json.Marshal(ngsscConfig.populatedEnvironmentVariables)
+// compileVariablePattern compiles an entry of environmentVariables, which is
+// either a wildcard pattern (e.g. NG_PUBLIC_*) or a regular expression
+// enclosed in slashes (e.g. /^NG_(PUBLIC|FEATURE)_/). For a name nil is
+// returned.
+func compileVariablePattern(entry string) (*regexp.Regexp, error) {
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		return regexp.Compile(entry[1 : len(entry)-1])
+	} else if strings.Contains(entry, "*") {
+		return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(entry), `\*`, ".*") + "$"), nil
+	}
+
+	return nil, nil
+}
+
+// Snapshot returns the current state of the app variables.
+func (appVariables *AppVariables) Snapshot() Snapshot {
+	state := appVariables.state.Load()
+	return Snapshot{appVariables.Variant, state.variables, state.lastChangedAt}
+}
+
+// Insert inserts the current variables into the HTML (see Snapshot.Insert).
+func (appVariables *AppVariables) Insert(htmlBytes []byte, calculateCspHash bool) ([]byte, string) {
+	return appVariables.Snapshot().Insert(htmlBytes, "", calculateCspHash)
+}
+
+// Insert inserts the variables as a script into the HTML. If a CSP nonce is
+// given, it is used as the value of NGSS_CSP_NONCE for this HTML only.
+func (snapshot Snapshot) Insert(htmlBytes []byte, cspNonce string, calculateCspHash bool) ([]byte, string) {
+	variables := snapshot.Variables
+	if _, ok := variables["NGSS_CSP_NONCE"]; ok && len(cspNonce) > 0 {
+		variables = maps.Clone(variables)
+		variables["NGSS_CSP_NONCE"] = &cspNonce
+	}
+	jsonBytes, _ := json.Marshal(variables)
 	envMapJSON := string(jsonBytes)
 	var iife string
-	if ngsscConfig.Variant == "NG_ENV" {
+	if snapshot.Variant == "NG_ENV" {
 		iife = fmt.Sprintf("self.NG_ENV=%v", envMapJSON)
-	} else if ngsscConfig.Variant == "global" {
+	} else if snapshot.Variant == "global" {
 		iife = fmt.Sprintf("Object.assign(self,%v)", envMapJSON)
 	} else {
 		iife = fmt.Sprintf(`self.process={"env":%v}`, envMapJSON)
@@ -100,7 +143,6 @@ func (ngsscConfig AppVariables) Insert(htmlBytes []byte, calculateCspHash bool)
 
 	iifeScript := fmt.Sprintf("<script>%v</script>", iifeContent)
 	html := string(htmlBytes)
-	configRegex := regexp.MustCompile(`<!--\s*CONFIG\s*-->`)
 	if configRegex.Match(htmlBytes) {
 		html = configRegex.ReplaceAllString(html, iifeScript)
 	} else if strings.Contains(html, "</title>") {
@@ -112,38 +154,59 @@ func (ngsscConfig AppVariables) Insert(htmlBytes []byte, calculateCspHash bool)
 	return []byte(html), cspHash
 }
 
+var configRegex = regexp.MustCompile(`<!--\s*CONFIG\s*-->`)
+
+func (snapshot Snapshot) IsEmpty() bool {
+	return len(snapshot.Variables) == 0
+}
+
+func (snapshot Snapshot) Has(key string) bool {
+	_, ok := snapshot.Variables[key]
+	return ok
+}
+
+// MergeVariables publishes a new snapshot with the given variables. If the
+// environment variables are defined by ngssc.json, only these are used and
+// missing variables are read from the environment. Variables, which no
+// longer match a pattern, are removed. Otherwise only the public variables
+// are used.
 func (appVariables *AppVariables) MergeVariables(variables map[string]*string) {
-	appVariables.LastChangedAt = time.Now()
+	appVariables.mutex.Lock()
+	defer appVariables.mutex.Unlock()
 	if len(appVariables.EnvironmentVariables) > 0 {
-		for k := range appVariables.populatedEnvironmentVariables {
-			value, ok := variables[k]
-			if ok {
-				appVariables.populatedEnvironmentVariables[k] = value
-			} else {
-				value, ok := os.LookupEnv(k)
-				if ok {
-					appVariables.populatedEnvironmentVariables[k] = &value
-				} else {
-					appVariables.populatedEnvironmentVariables[k] = nil
-				}
-			}
-		}
-	} else {
-		appVariables.populatedEnvironmentVariables = variables
+		variables = populateEnvironmentVariables(appVariables.EnvironmentVariables, variables)
+	} else if appVariables.Public != nil {
+		variables, _ = appVariables.Public.Filter(variables)
 	}
+	appVariables.state.Store(&variablesState{variables, time.Now()})
+}
+
+// HasSameConfiguration returns whether the other app variables are
+// configured identically, e.g. by an unchanged ngssc.json.
+func (appVariables *AppVariables) HasSameConfiguration(other *AppVariables) bool {
+	return other != nil &&
+		appVariables.Variant == other.Variant &&
+		slices.Equal(appVariables.EnvironmentVariables, other.EnvironmentVariables) &&
+		appVariables.Dir == other.Dir &&
+		appVariables.FilePattern == other.FilePattern
 }
 
 func (appVariables *AppVariables) IsEmpty() bool {
-	return len(appVariables.populatedEnvironmentVariables) == 0
+	return appVariables.Snapshot().IsEmpty()
 }
 
 func (appVariables *AppVariables) Has(key string) bool {
-	_, ok := appVariables.populatedEnvironmentVariables[key]
-	return ok
+	return appVariables.Snapshot().Has(key)
 }
 
+// Update publishes a new snapshot with the value of an existing variable.
 func (appVariables *AppVariables) Update(key string, value string) {
-	if appVariables.Has(key) {
-		appVariables.populatedEnvironmentVariables[key] = &value
+	appVariables.mutex.Lock()
+	defer appVariables.mutex.Unlock()
+	current := appVariables.state.Load().variables
+	if _, ok := current[key]; ok {
+		variables := maps.Clone(current)
+		variables[key] = &value
+		appVariables.state.Store(&variablesState{variables, time.Now()})
 	}
 }
@@ -2,6 +2,8 @@ package config
 
 import (
 	"ngstaticserver/test"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -15,7 +17,7 @@ func TestIsEmpty(t *testing.T) {
 func TestReadingNgsscJson(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("ngssc")
-	appVariables := InitializeAppVariables(context.Path)
+	appVariables := readNgsscJson(t, context)
 	test.AssertTrue(
 		t,
 		reflect.DeepEqual(appVariables.EnvironmentVariables, []string{"LABEL", "NGSS_CSP_NONCE"}))
@@ -26,7 +28,7 @@ func TestReadingNgsscJson(t *testing.T) {
 func TestInsert(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("ngssc")
-	appVariables := InitializeAppVariables(context.Path)
+	appVariables := readNgsscJson(t, context)
 	content, _ := appVariables.Insert([]byte("<!--CONFIG-->"), false)
 	test.AssertEqual(t, string(content), "<script>(function(self){self.process={\"env\":{\"LABEL\":null,\"NGSS_CSP_NONCE\":null}};})(window)</script>")
 }
@@ -34,7 +36,7 @@ func TestInsert(t *testing.T) {
 func TestInsertProcess(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("ngssc")
-	appVariables := InitializeAppVariables(context.Path)
+	appVariables := readNgsscJson(t, context)
 	appVariables.Variant = "global"
 	content, _ := appVariables.Insert([]byte("</title>"), false)
 	test.AssertEqual(t, string(content), "</title><script>(function(self){Object.assign(self,{\"LABEL\":null,\"NGSS_CSP_NONCE\":null});})(window)</script>")
@@ -43,7 +45,7 @@ func TestInsertProcess(t *testing.T) {
 func TestInsertNgEnv(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("ngssc")
-	appVariables := InitializeAppVariables(context.Path)
+	appVariables := readNgsscJson(t, context)
 	appVariables.Variant = "NG_ENV"
 	content, _ := appVariables.Insert([]byte("</head>"), false)
 	test.AssertEqual(t, string(content), "<script>(function(self){self.NG_ENV={\"LABEL\":null,\"NGSS_CSP_NONCE\":null};})(window)</script></head>")
@@ -52,10 +54,90 @@ func TestInsertNgEnv(t *testing.T) {
 func TestUpdate(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("ngssc")
-	appVariables := InitializeAppVariables(context.Path)
+	appVariables := readNgsscJson(t, context)
 	content, _ := appVariables.Insert([]byte("<!--CONFIG-->"), false)
 	test.AssertEqual(t, string(content), "<script>(function(self){self.process={\"env\":{\"LABEL\":null,\"NGSS_CSP_NONCE\":null}};})(window)</script>")
 	appVariables.Update("LABEL", "label")
 	content, _ = appVariables.Insert([]byte("<!--CONFIG-->"), false)
 	test.AssertEqual(t, string(content), "<script>(function(self){self.process={\"env\":{\"LABEL\":\"label\",\"NGSS_CSP_NONCE\":null}};})(window)</script>")
 }
+
+func TestSnapshotIsImmutable(t *testing.T) {
+	appVariables := DefaultAppVariables()
+	value := "first"
+	appVariables.MergeVariables(map[string]*string{"LABEL": &value})
+	snapshot := appVariables.Snapshot()
+
+	changed := "second"
+	appVariables.MergeVariables(map[string]*string{"LABEL": &changed})
+	appVariables.Update("LABEL", "third")
+
+	test.AssertEqual(t, *snapshot.Variables["LABEL"], "first")
+	test.AssertEqual(t, *appVariables.Snapshot().Variables["LABEL"], "third")
+	test.AssertTrue(t, appVariables.Snapshot().LastChangedAt.Compare(snapshot.LastChangedAt) >= 0)
+}
+
+func TestInsertCspNonce(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("ngssc")
+	appVariables := readNgsscJson(t, context)
+	snapshot := appVariables.Snapshot()
+	content, hash := snapshot.Insert([]byte("<!--CONFIG-->"), "abc", true)
+	test.AssertEqual(t, string(content), "<script>(function(self){self.process={\"env\":{\"LABEL\":null,\"NGSS_CSP_NONCE\":\"abc\"}};})(window)</script>")
+	test.AssertTrue(t, len(hash) > 0)
+	test.AssertTrue(t, snapshot.Variables["NGSS_CSP_NONCE"] == nil)
+	test.AssertTrue(t, appVariables.Snapshot().Variables["NGSS_CSP_NONCE"] == nil)
+}
+
+func TestVariablePatterns(t *testing.T) {
+	t.Setenv("NG_PUBLIC_API", "api")
+	t.Setenv("NG_FEATURE_X", "x")
+	t.Setenv("SECRET", "secret")
+	context := test.NewTestDir(t)
+	context.WriteFile("ngssc.json", `{"variant":"global","environmentVariables":["LABEL","NG_PUBLIC_*","/^NG_FEATURE_/"]}`)
+	appVariables := readNgsscJson(t, context)
+	content, _ := appVariables.Insert([]byte("</head>"), false)
+	test.AssertEqual(t, string(content), "<script>(function(self){Object.assign(self,{\"LABEL\":null,\"NG_FEATURE_X\":\"x\",\"NG_PUBLIC_API\":\"api\"});})(window)</script></head>")
+
+	value := "url"
+	appVariables.MergeVariables(map[string]*string{"NG_PUBLIC_URL": &value, "OTHER": &value})
+	test.AssertTrue(t, appVariables.Has("NG_PUBLIC_URL"))
+	test.AssertTrue(t, appVariables.Has("NG_PUBLIC_API"))
+	test.AssertTrue(t, !appVariables.Has("OTHER"))
+
+	os.Unsetenv("NG_PUBLIC_API")
+	appVariables.MergeVariables(map[string]*string{})
+	test.AssertTrue(t, !appVariables.Has("NG_PUBLIC_API"))
+	test.AssertTrue(t, !appVariables.Has("NG_PUBLIC_URL"))
+	test.AssertTrue(t, appVariables.Has("LABEL"))
+}
+
+func TestMergePublicVariables(t *testing.T) {
+	appVariables := DefaultAppVariables()
+	appVariables.Public = &PublicVariables{Prefix: "NG_PUBLIC_", Names: []string{"REGION"}}
+	api, region, password := "api", "eu", "secret"
+	appVariables.MergeVariables(map[string]*string{"NG_PUBLIC_API": &api, "REGION": &region, "DB_PASSWORD": &password})
+	test.AssertTrue(t, appVariables.Has("NG_PUBLIC_API"))
+	test.AssertTrue(t, appVariables.Has("REGION"))
+	test.AssertTrue(t, !appVariables.Has("DB_PASSWORD"))
+
+	// Without a prefix or names, no variable is public
+	appVariables.Public = &PublicVariables{}
+	appVariables.MergeVariables(map[string]*string{"NG_PUBLIC_API": &api, "DB_PASSWORD": &password})
+	test.AssertTrue(t, appVariables.IsEmpty())
+}
+
+func TestFilterPublicVariables(t *testing.T) {
+	value := "value"
+	public, skipped := PublicVariables{Names: []string{"A"}}.Filter(
+		map[string]*string{"A": &value, "C": &value, "B": &value})
+	test.AssertEqual(t, len(public), 1)
+	test.AssertTrue(t, reflect.DeepEqual(skipped, []string{"B", "C"}))
+}
+
+func readNgsscJson(t *testing.T, context test.TestDir) *AppVariables {
+	t.Helper()
+	appVariables, err := ReadNgsscJson(filepath.Join(context.Path, "ngssc.json"))
+	test.AssertNoError(t, err)
+	return appVariables
+}
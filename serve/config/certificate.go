@@ -0,0 +1,119 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Certificate holds the TLS key pair (and optionally the CA bundle used to
+// verify client certificates) and reloads it when the files are rotated.
+type Certificate struct {
+	certFile     string
+	keyFile      string
+	clientCaFile string
+	keyPair      atomic.Pointer[tls.Certificate]
+	clientCAs    atomic.Pointer[x509.CertPool]
+}
+
+func LoadCertificate(certFile, keyFile, clientCaFile string) (*Certificate, error) {
+	certificate := &Certificate{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCaFile: clientCaFile,
+	}
+	err := certificate.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return certificate, nil
+}
+
+// Reload reads the certificate files again. On failure the previously
+// loaded certificate is kept.
+func (certificate *Certificate) Reload() error {
+	keyPair, err := tls.LoadX509KeyPair(certificate.certFile, certificate.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate %v: %w", certificate.certFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if len(certificate.clientCaFile) > 0 {
+		content, err := os.ReadFile(certificate.clientCaFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle %v: %w", certificate.clientCaFile, err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificates found in client CA bundle %v", certificate.clientCaFile)
+		}
+	}
+
+	certificate.keyPair.Store(&keyPair)
+	certificate.clientCAs.Store(clientCAs)
+	return nil
+}
+
+func (certificate *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return certificate.keyPair.Load(), nil
+}
+
+// TLSConfig returns a configuration which resolves the current certificate
+// (and client CA bundle) for every handshake.
+func (certificate *Certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     []string{"h2", "http/1.1"},
+				GetCertificate: certificate.GetCertificate,
+			}
+			if clientCAs := certificate.clientCAs.Load(); clientCAs != nil {
+				config.ClientCAs = clientCAs
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
+	}
+}
+
+// Watchables returns a WatchableFile for each file the certificate is
+// loaded from, so it can be registered with the FileWatcher.
+func (certificate *Certificate) Watchables() []WatchableFile {
+	watchables := []WatchableFile{
+		certificateFile{certificate, certificate.certFile},
+		certificateFile{certificate, certificate.keyFile},
+	}
+	if len(certificate.clientCaFile) > 0 {
+		watchables = append(watchables, certificateFile{certificate, certificate.clientCaFile})
+	}
+
+	return watchables
+}
+
+type certificateFile struct {
+	certificate *Certificate
+	path        string
+}
+
+func (file certificateFile) Dir() string {
+	return filepath.Dir(file.path)
+}
+
+func (file certificateFile) Name() string {
+	return filepath.Base(file.path)
+}
+
+func (file certificateFile) HandleChange() {
+	slog.Info(fmt.Sprintf("Detected change in %v. Reloading TLS certificate.", file.path))
+	err := file.certificate.Reload()
+	if err != nil {
+		slog.Error("Failed to reload TLS certificate. Continuing with previous certificate.", "error", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"testing"
+	"time"
+)
+
+func TestLoadCertificate(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteCertificate("tls.crt", "tls.key", "first")
+
+	certificate, err := LoadCertificate(context.Join("tls.crt"), context.Join("tls.key"), "")
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, commonName(t, certificate), "first")
+	test.AssertTrue(t, certificate.clientCAs.Load() == nil)
+	test.AssertEqual(t, len(certificate.Watchables()), 2)
+}
+
+func TestLoadCertificate_missing(t *testing.T) {
+	context := test.NewTestDir(t)
+
+	_, err := LoadCertificate(context.Join("tls.crt"), context.Join("tls.key"), "")
+	test.AssertTrue(t, err != nil)
+}
+
+func TestLoadCertificate_clientCa(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteCertificate("tls.crt", "tls.key", "server")
+	context.WriteCertificate("ca.crt", "ca.key", "ca")
+
+	certificate, err := LoadCertificate(context.Join("tls.crt"), context.Join("tls.key"), context.Join("ca.crt"))
+	test.AssertNoError(t, err)
+	test.AssertTrue(t, certificate.clientCAs.Load() != nil)
+	test.AssertEqual(t, len(certificate.Watchables()), 3)
+
+	config, err := certificate.TLSConfig().GetConfigForClient(nil)
+	test.AssertNoError(t, err)
+	test.AssertTrue(t, config.ClientCAs != nil)
+}
+
+func TestReloadCertificate_invalid(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteCertificate("tls.crt", "tls.key", "first")
+	certificate, err := LoadCertificate(context.Join("tls.crt"), context.Join("tls.key"), "")
+	test.AssertNoError(t, err)
+
+	context.WriteFile("tls.crt", "invalid")
+	err = certificate.Reload()
+	test.AssertTrue(t, err != nil)
+	test.AssertEqual(t, commonName(t, certificate), "first")
+}
+
+func TestReloadCertificateOnChange(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteCertificate("tls.crt", "tls.key", "first")
+	certificate, err := LoadCertificate(context.Join("tls.crt"), context.Join("tls.key"), "")
+	test.AssertNoError(t, err)
+
+	fileWatcher := createFileWatcher(t, WatchOptions{Mode: WatchModeInotify})
+	for _, watchable := range certificate.Watchables() {
+		test.AssertNoError(t, fileWatcher.Watch(watchable))
+	}
+
+	context.WriteCertificate("tls.crt", "tls.key", "second")
+	time.Sleep(time.Millisecond * 50)
+
+	test.AssertEqual(t, commonName(t, certificate), "second")
+}
+
+func commonName(t *testing.T, certificate *Certificate) string {
+	t.Helper()
+	keyPair, err := certificate.GetCertificate(nil)
+	test.AssertNoError(t, err)
+	if keyPair.Leaf != nil {
+		return keyPair.Leaf.Subject.CommonName
+	}
+	return ""
+}
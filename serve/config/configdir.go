@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dataLink is the symlink of a Kubernetes ConfigMap or Secret volume, which
+// points to the directory with the current files. It is swapped atomically
+// on each update of the volume.
+const dataLink = "..data"
+
+// ConfigDir reads each file of a directory as a variable, with the file name
+// as the key (e.g. a Kubernetes ConfigMap or Secret volume or /run/secrets).
+type ConfigDir struct {
+	dir      string
+	env      map[string]*string
+	onChange func(variables map[string]*string)
+}
+
+func CreateConfigDir(dir string, onChange func(variables map[string]*string)) *ConfigDir {
+	slog.Info(fmt.Sprintf("Detected config directory at %v. Reading variables and adding watch.", dir))
+	instance := ConfigDir{
+		dir:      dir,
+		env:      readConfigDir(dir),
+		onChange: onChange,
+	}
+	onChange(instance.env)
+	return &instance
+}
+
+func (configDir *ConfigDir) Dir() string {
+	return configDir.dir
+}
+
+func (configDir *ConfigDir) Name() string {
+	return dataLink
+}
+
+// Matches returns whether a change of the file with the given name changes
+// the variables. With the ..data layout only the swap of the symlink does,
+// as the files are links into the directory it points to.
+func (configDir *ConfigDir) Matches(name string) bool {
+	if _, err := os.Lstat(filepath.Join(configDir.dir, dataLink)); err == nil {
+		return name == dataLink
+	}
+
+	return !strings.HasPrefix(name, ".")
+}
+
+func (configDir *ConfigDir) HandleChange() {
+	slog.Info(fmt.Sprintf("Detected change in %v. Reading variables.", configDir.dir))
+	configDir.env = readConfigDir(configDir.dir)
+	configDir.onChange(configDir.env)
+}
+
+// readConfigDir reads the files of the directory with their trailing newlines
+// trimmed. Hidden files and directories (e.g. ..data) are skipped.
+func readConfigDir(dir string) map[string]*string {
+	result := make(map[string]*string)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to read config directory at %v. Continuing without its variables.", dir))
+		return result
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		filePath := filepath.Join(dir, name)
+		if strings.HasPrefix(name, ".") || !fileExists(filePath) {
+			continue
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to read %v. Skipping variable %v.", filePath, name))
+			continue
+		}
+		value := strings.TrimRight(string(content), "\r\n")
+		result[name] = &value
+	}
+
+	return result
+}
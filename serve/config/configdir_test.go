@@ -0,0 +1,57 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShouldReadConfigDir(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile("API_URL", "https://example.com\n")
+	context.WriteFile("REGION", "eu\r\n")
+	context.WriteFile(".hidden", "hidden")
+	test.AssertNoError(t, os.Mkdir(filepath.Join(context.Path, "nested"), 0755))
+
+	var result map[string]*string
+	CreateConfigDir(context.Path, func(variables map[string]*string) {
+		result = variables
+	})
+
+	test.AssertEqual(t, len(result), 2)
+	test.AssertEqual(t, readValue(t, result, "API_URL"), "https://example.com")
+	test.AssertEqual(t, readValue(t, result, "REGION"), "eu")
+}
+
+func TestShouldReloadConfigDirOnSwap(t *testing.T) {
+	context := test.NewTestDir(t)
+	writeConfigMapData(t, context, "..2024_01", "first")
+	test.AssertNoError(t, os.Symlink("..2024_01", filepath.Join(context.Path, "..data")))
+	test.AssertNoError(t, os.Symlink("..data/LABEL", filepath.Join(context.Path, "LABEL")))
+
+	fileWatcher := createFileWatcher(t, WatchOptions{Mode: WatchModeInotify})
+	testEnv := &testEnvState{env: make(map[string]*string)}
+	configDir := CreateConfigDir(context.Path, testEnv.handleChange)
+	test.AssertNoError(t, fileWatcher.Watch(configDir))
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "LABEL"), "first")
+	test.AssertTrue(t, configDir.Matches("..data"))
+	test.AssertTrue(t, !configDir.Matches("LABEL"))
+
+	// Swap the volume like the kubelet does.
+	writeConfigMapData(t, context, "..2024_02", "second")
+	test.AssertNoError(t, os.Symlink("..2024_02", filepath.Join(context.Path, "..data_tmp")))
+	test.AssertNoError(t, os.Rename(filepath.Join(context.Path, "..data_tmp"), filepath.Join(context.Path, "..data")))
+
+	time.Sleep(time.Millisecond * 50)
+
+	test.AssertEqual(t, len(testEnv.variables()), 1)
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "LABEL"), "second")
+}
+
+func writeConfigMapData(t *testing.T, context test.TestDir, dir string, label string) {
+	t.Helper()
+	test.AssertNoError(t, os.Mkdir(filepath.Join(context.Path, dir), 0755))
+	context.WriteFile(filepath.Join(dir, "LABEL"), label+"\n")
+}
@@ -12,8 +12,10 @@ import (
 )
 
 type DotEnv struct {
-	dir      string
-	name     string
+	dir  string
+	name string
+	// source is the path of the file the variables were read from.
+	source   string
 	env      map[string]*string
 	onChange func(variables map[string]*string)
 }
@@ -21,18 +23,55 @@ type DotEnv struct {
 func CreateDotEnv(workingDirectory string, onChange func(variables map[string]*string)) *DotEnv {
 	configEnvPath := filepath.Join(workingDirectory, "../config/.env")
 	var env map[string]*string
+	source := configEnvPath
 	if _, err := os.Stat(configEnvPath); err == nil {
 		slog.Info(fmt.Sprintf("Detected .env file at %v. Reading variables and adding watch.", configEnvPath))
 		env = parseDotEnv(configEnvPath)
 	} else {
-		localEnv := filepath.Join(workingDirectory, ".env")
-		slog.Info(fmt.Sprintf("Detected .env file at %v. Reading variables.", localEnv))
+		source = filepath.Join(workingDirectory, ".env")
+		slog.Info(fmt.Sprintf("Detected .env file at %v. Reading variables and adding watch.", source))
+		env = parseDotEnv(source)
+	}
+
+	return newDotEnv(configEnvPath, source, env, onChange)
+}
+
+// CreateLocaleDotEnv reads the .env.<locale> overlay of a locale, which is
+// looked up like the .env file. A missing overlay results in no variables.
+func CreateLocaleDotEnv(workingDirectory string, locale string, onChange func(variables map[string]*string)) *DotEnv {
+	return createOptionalDotEnv(workingDirectory, ".env."+locale, onChange)
+}
+
+// createOptionalDotEnv reads the .env file with the given name, which is
+// looked up like the .env file. A missing file results in no variables.
+func createOptionalDotEnv(workingDirectory string, name string, onChange func(variables map[string]*string)) *DotEnv {
+	configEnvPath := filepath.Join(workingDirectory, "../config", name)
+	env := make(map[string]*string)
+	source := configEnvPath
+	if _, err := os.Stat(configEnvPath); err == nil {
+		slog.Info(fmt.Sprintf("Detected %v file at %v. Reading variables and adding watch.", name, configEnvPath))
+		env = parseDotEnv(configEnvPath)
+	} else if localEnv := filepath.Join(workingDirectory, name); fileExists(localEnv) {
+		slog.Info(fmt.Sprintf("Detected %v file at %v. Reading variables and adding watch.", name, localEnv))
 		env = parseDotEnv(localEnv)
+		source = localEnv
 	}
 
+	return newDotEnv(configEnvPath, source, env, onChange)
+}
+
+// newDotEnv watches the file in the directory it was read from. If it was
+// found in neither directory, the config directory is watched, so that a
+// file mounted later is detected.
+func newDotEnv(configEnvPath string, source string, env map[string]*string, onChange func(variables map[string]*string)) *DotEnv {
+	watchedPath := configEnvPath
+	if source != configEnvPath && fileExists(source) {
+		watchedPath = source
+	}
 	instance := DotEnv{
-		dir:      path.Dir(configEnvPath),
-		name:     path.Base(configEnvPath),
+		dir:      path.Dir(watchedPath),
+		name:     path.Base(watchedPath),
+		source:   source,
 		env:      env,
 		onChange: onChange,
 	}
@@ -52,6 +91,7 @@ func (dotEnv *DotEnv) HandleChange() {
 	filePath := filepath.Join(dotEnv.dir, dotEnv.name)
 	slog.Info(fmt.Sprintf("Detected change in %v. Reading variables.", filePath))
 	dotEnv.env = parseDotEnv(filePath)
+	dotEnv.source = filePath
 	dotEnv.onChange(dotEnv.env)
 }
 
@@ -77,3 +117,8 @@ func parseDotEnv(filePath string) map[string]*string {
 
 	return result
 }
+
+func fileExists(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// LayeredDotEnv merges the layers of .env files (see DotEnvLayers), where
+// later layers override the variables of earlier layers, and expands
+// ${NAME} references in the values.
+type LayeredDotEnv struct {
+	mutex     sync.Mutex
+	layers    []*DotEnv
+	variables []map[string]*string
+	// sources contains the path each layer was read from.
+	sources  []string
+	onChange func(variables map[string]*string)
+	// ready is set once all layers are read.
+	ready bool
+}
+
+// DotEnvLayers returns the names of the .env files in the order of their
+// precedence (lowest first) for the given app environment (e.g. production).
+func DotEnvLayers(appEnv string) []string {
+	names := []string{".env", ".env.local"}
+	if len(appEnv) > 0 {
+		names = append(names, ".env."+appEnv, ".env."+appEnv+".local")
+	}
+
+	return names
+}
+
+// CreateLayeredDotEnv reads the layers of .env files, each of which is
+// looked up like the .env file (see CreateDotEnv).
+func CreateLayeredDotEnv(workingDirectory string, appEnv string, onChange func(variables map[string]*string)) *LayeredDotEnv {
+	names := DotEnvLayers(appEnv)
+	layeredDotEnv := &LayeredDotEnv{
+		layers:    make([]*DotEnv, len(names)),
+		variables: make([]map[string]*string, len(names)),
+		sources:   make([]string, len(names)),
+		onChange:  onChange,
+	}
+	for i, name := range names {
+		update := func(variables map[string]*string) {
+			layeredDotEnv.update(i, variables)
+		}
+		if i == 0 {
+			layeredDotEnv.layers[i] = CreateDotEnv(workingDirectory, update)
+		} else {
+			layeredDotEnv.layers[i] = createOptionalDotEnv(workingDirectory, name, update)
+		}
+	}
+	layeredDotEnv.mutex.Lock()
+	defer layeredDotEnv.mutex.Unlock()
+	for i, layer := range layeredDotEnv.layers {
+		layeredDotEnv.sources[i] = layer.source
+	}
+	layeredDotEnv.ready = true
+	layeredDotEnv.merge()
+	return layeredDotEnv
+}
+
+// Watchables returns a WatchableFile for each layer, so they can be
+// registered with the FileWatcher.
+func (layeredDotEnv *LayeredDotEnv) Watchables() []WatchableFile {
+	watchables := make([]WatchableFile, len(layeredDotEnv.layers))
+	for i, layer := range layeredDotEnv.layers {
+		watchables[i] = layer
+	}
+
+	return watchables
+}
+
+// update replaces the variables of the layer at the given index.
+func (layeredDotEnv *LayeredDotEnv) update(index int, variables map[string]*string) {
+	layeredDotEnv.mutex.Lock()
+	defer layeredDotEnv.mutex.Unlock()
+	layeredDotEnv.variables[index] = variables
+	if layeredDotEnv.ready {
+		// The layer is updated by its HandleChange, which set its source.
+		layeredDotEnv.sources[index] = layeredDotEnv.layers[index].source
+		layeredDotEnv.merge()
+	}
+}
+
+// merge calls onChange with the merged and expanded variables of the layers.
+func (layeredDotEnv *LayeredDotEnv) merge() {
+	merged := make(map[string]*string)
+	sources := make(map[string]string)
+	for i, layer := range layeredDotEnv.variables {
+		for name, value := range layer {
+			merged[name] = value
+			sources[name] = layeredDotEnv.sources[i]
+		}
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		slog.Debug(fmt.Sprintf("Variable %v is provided by %v", name, sources[name]))
+	}
+	layeredDotEnv.onChange(expandVariables(merged))
+}
+
+var expansionRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVariables replaces ${NAME} in the values with the value of the
+// variable NAME, which is looked up in the variables and then in the process
+// environment. Undefined references are replaced with an empty string and
+// variables, which are part of a reference cycle, are set to an empty string.
+func expandVariables(variables map[string]*string) map[string]*string {
+	cyclic := findCyclicVariables(variables)
+	result := make(map[string]*string, len(variables))
+	var expand func(name string) string
+	expand = func(name string) string {
+		if value, ok := result[name]; ok && value != nil {
+			return *value
+		}
+		value, ok := variables[name]
+		if !ok || value == nil {
+			return os.Getenv(name)
+		}
+
+		// Without the cyclic variables, the references are acyclic.
+		expanded := ""
+		if !cyclic[name] {
+			expanded = expansionRegex.ReplaceAllStringFunc(*value, func(reference string) string {
+				return expand(reference[2 : len(reference)-1])
+			})
+		}
+		result[name] = &expanded
+		return expanded
+	}
+	for name, value := range variables {
+		if value == nil {
+			result[name] = nil
+		} else {
+			expand(name)
+		}
+	}
+
+	return result
+}
+
+// findCyclicVariables returns the variables, which reference themselves
+// directly or through other variables. These are the strongly connected
+// components of the references with more than one variable or a self
+// reference, which are found with Tarjan's algorithm, so that the result does
+// not depend on the order of the variables.
+func findCyclicVariables(variables map[string]*string) map[string]bool {
+	cyclic := make(map[string]bool)
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		lowLink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, match := range expansionRegex.FindAllStringSubmatch(*variables[name], -1) {
+			reference := match[1]
+			if value, ok := variables[reference]; !ok || value == nil {
+				continue
+			} else if reference == name {
+				cyclic[name] = true
+			} else if _, visited := index[reference]; !visited {
+				connect(reference)
+				lowLink[name] = min(lowLink[name], lowLink[reference])
+			} else if onStack[reference] {
+				lowLink[name] = min(lowLink[name], index[reference])
+			}
+		}
+
+		if lowLink[name] == index[name] {
+			start := len(stack) - 1
+			for stack[start] != name {
+				start--
+			}
+			for _, member := range stack[start:] {
+				onStack[member] = false
+				if len(stack)-start > 1 {
+					cyclic[member] = true
+				}
+			}
+			stack = stack[:start]
+		}
+	}
+	for name, value := range variables {
+		if _, visited := index[name]; !visited && value != nil {
+			connect(name)
+		}
+	}
+
+	return cyclic
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDotEnvLayers(t *testing.T) {
+	test.AssertTrue(t, reflect.DeepEqual(DotEnvLayers(""), []string{".env", ".env.local"}))
+	test.AssertTrue(t, reflect.DeepEqual(
+		DotEnvLayers("production"), []string{".env", ".env.local", ".env.production", ".env.production.local"}))
+}
+
+func TestLayeredDotEnvPrecedence(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(".env", "A=env\nB=env\nC=env\nD=env")
+	context.WriteFile(".env.local", "B=local\nC=local\nD=local")
+	context.WriteFile(".env.production", "C=production\nD=production")
+	test.AssertNoError(t, os.WriteFile(filepath.Join(context.Path, "../config/.env.production.local"), []byte("D=config"), 0644))
+
+	var result map[string]*string
+	CreateLayeredDotEnv(context.Path, "production", func(variables map[string]*string) {
+		result = variables
+	})
+	test.AssertEqual(t, readValue(t, result, "A"), "env")
+	test.AssertEqual(t, readValue(t, result, "B"), "local")
+	test.AssertEqual(t, readValue(t, result, "C"), "production")
+	test.AssertEqual(t, readValue(t, result, "D"), "config")
+
+	CreateLayeredDotEnv(context.Path, "", func(variables map[string]*string) {
+		result = variables
+	})
+	test.AssertEqual(t, readValue(t, result, "C"), "local")
+	test.AssertEqual(t, readValue(t, result, "D"), "local")
+}
+
+func TestLayeredDotEnvExpansion(t *testing.T) {
+	t.Setenv("PROCESS_HOST", "process.example.com")
+	context := test.NewTestDir(t)
+	context.WriteFile(".env", "HOST=example.com\nAPI_URL=https://${HOST}/api\nPROCESS_URL=https://${PROCESS_HOST}\n"+
+		"MISSING=${UNDEFINED_VARIABLE}\nCYCLE_A=a${CYCLE_B}\nCYCLE_B=b${CYCLE_A}\nPLAIN=$HOST\n"+
+		"SELF=s${SELF}\nCYCLE_USER=u${CYCLE_A}${HOST}")
+	context.WriteFile(".env.local", "HOST=local.example.com")
+
+	var result map[string]*string
+	CreateLayeredDotEnv(context.Path, "", func(variables map[string]*string) {
+		result = variables
+	})
+	test.AssertEqual(t, readValue(t, result, "API_URL"), "https://local.example.com/api")
+	test.AssertEqual(t, readValue(t, result, "PROCESS_URL"), "https://process.example.com")
+	test.AssertEqual(t, readValue(t, result, "MISSING"), "")
+	test.AssertEqual(t, readValue(t, result, "CYCLE_A"), "")
+	test.AssertEqual(t, readValue(t, result, "CYCLE_B"), "")
+	test.AssertEqual(t, readValue(t, result, "SELF"), "")
+	test.AssertEqual(t, readValue(t, result, "CYCLE_USER"), "ulocal.example.com")
+	test.AssertEqual(t, readValue(t, result, "PLAIN"), "$HOST")
+}
+
+func TestLayeredDotEnvWatchesLayersInAppDirectory(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(".env.local", "LABEL=local")
+
+	fileWatcher := createFileWatcher(t, WatchOptions{Mode: WatchModeInotify})
+	testEnv := &testEnvState{env: make(map[string]*string)}
+	layeredDotEnv := CreateLayeredDotEnv(context.Path, "", testEnv.handleChange)
+	for _, watchable := range layeredDotEnv.Watchables() {
+		test.AssertNoError(t, fileWatcher.Watch(watchable))
+	}
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "LABEL"), "local")
+
+	context.WriteFile(".env.local", "LABEL=changed")
+	time.Sleep(time.Millisecond * 50)
+
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "LABEL"), "changed")
+}
+
+func TestExpandVariablesCycles(t *testing.T) {
+	value := func(value string) *string {
+		return &value
+	}
+	// A -> C -> B -> A is a cycle regardless of the variable the expansion
+	// starts with, while D only references the cycle.
+	variables := map[string]*string{
+		"A": value("a${B}${C}"),
+		"B": value("b${A}"),
+		"C": value("c${B}"),
+		"D": value("d${C}"),
+		"E": value("e"),
+	}
+	for i := 0; i < 20; i++ {
+		result := expandVariables(variables)
+		for name, expected := range map[string]string{"A": "", "B": "", "C": "", "D": "d", "E": "e"} {
+			test.AssertEqual(t, readValue(t, result, name), expected)
+		}
+	}
+}
+
+func TestLayeredDotEnvWatchesEveryLayer(t *testing.T) {
+	context := test.NewTestDir(t)
+	configDir := filepath.Join(context.Path, "../config")
+	test.AssertNoError(t, os.WriteFile(filepath.Join(configDir, ".env"), []byte("LABEL=env\nURL=${LABEL}"), 0644))
+
+	fileWatcher := createFileWatcher(t, WatchOptions{Mode: WatchModeInotify})
+	testEnv := &testEnvState{env: make(map[string]*string)}
+	layeredDotEnv := CreateLayeredDotEnv(context.Path, "production", testEnv.handleChange)
+	test.AssertEqual(t, len(layeredDotEnv.Watchables()), 4)
+	for _, watchable := range layeredDotEnv.Watchables() {
+		test.AssertNoError(t, fileWatcher.Watch(watchable))
+	}
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "URL"), "env")
+
+	test.AssertNoError(t, os.WriteFile(filepath.Join(configDir, ".env.production.local"), []byte("LABEL=production"), 0644))
+	time.Sleep(time.Millisecond * 50)
+
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "LABEL"), "production")
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "URL"), "production")
+}
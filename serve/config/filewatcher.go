@@ -1,16 +1,34 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"log/slog"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// fileDebounce is how long the FileWatcher waits for the changes of a file
+// to settle, e.g. after its truncation by os.WriteFile or between the remove
+// and create events when an editor replaces a file.
+const fileDebounce = 10 * time.Millisecond
+
+// FileWatcher watches the directories of its WatchableFiles and calls
+// HandleChange of a WatchableFile once the changes of its file settled. Files
+// replaced by rename or symlink swap (e.g. the ..data symlink of a Kubernetes
+// volume) and directories, which are removed and created again, are handled.
 type FileWatcher struct {
-	watcher    *fsnotify.Watcher
-	watchables map[string][]WatchableFile
+	watcher  watchBackend
+	debounce time.Duration
+	// mutex guards watchables and the watched directories.
+	mutex      sync.Mutex
+	watchables map[string][]*watchEntry
+	// parents contains the watched parent directories of the directories in
+	// watchables, in order to detect directory swaps.
+	parents map[string]bool
 }
 
 type WatchableFile interface {
@@ -19,45 +37,67 @@ type WatchableFile interface {
 	Name() string
 }
 
-func CreateFileWatcher() *FileWatcher {
-	watcher, err := fsnotify.NewWatcher()
+// WatchableDir is a WatchableFile, which is notified about every change
+// (including created, removed and renamed files) of the files in its
+// directory, which it matches.
+type WatchableDir interface {
+	WatchableFile
+	Matches(name string) bool
+}
+
+// watchEntry debounces the changes of a WatchableFile and serializes the
+// calls of HandleChange.
+type watchEntry struct {
+	watchable WatchableFile
+	mutex     sync.Mutex
+	timer     *time.Timer
+	handling  sync.Mutex
+}
+
+// callbackFile is a WatchableFile which calls a function when it changes.
+type callbackFile struct {
+	path     string
+	onChange func()
+}
+
+func CallbackFile(filePath string, onChange func()) WatchableFile {
+	return callbackFile{filePath, onChange}
+}
+
+func (file callbackFile) Dir() string {
+	return path.Dir(file.path)
+}
+
+func (file callbackFile) Name() string {
+	return path.Base(file.path)
+}
+
+func (file callbackFile) HandleChange() {
+	file.onChange()
+}
+
+func CreateFileWatcher(options WatchOptions) (*FileWatcher, error) {
+	watcher, err := createWatchBackend(options)
 	if err != nil {
-		slog.Warn("Failed to create file watcher", "error", err)
-		return nil
+		return nil, err
 	}
 
 	fileWatcher := &FileWatcher{
 		watcher:    watcher,
-		watchables: make(map[string][]WatchableFile),
+		debounce:   fileDebounce,
+		watchables: make(map[string][]*watchEntry),
+		parents:    make(map[string]bool),
 	}
 
 	go func() {
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case event, ok := <-watcher.Events():
 				if !ok {
 					return
 				}
-				if event.Has(fsnotify.Write) {
-					dir := path.Dir(event.Name)
-					name := path.Base(event.Name)
-					watchables, ok := fileWatcher.watchables[dir]
-					if ok {
-						for _, watchable := range watchables {
-							if watchable.Name() == name {
-								// When e.g. using os.WriteFile, the truncation already triggers
-								// a change event, which results in the file being empty when
-								// calling HandleChange.
-								// Due to this, we wait for a millisecond, which should be enough for
-								// the write operation to finish.
-								time.Sleep(time.Millisecond)
-								watchable.HandleChange()
-							}
-							return
-						}
-					}
-				}
-			case err, ok := <-watcher.Errors:
+				fileWatcher.handleEvent(event)
+			case err, ok := <-watcher.Errors():
 				if !ok {
 					return
 				}
@@ -66,24 +106,108 @@ func CreateFileWatcher() *FileWatcher {
 		}
 	}()
 
-	return fileWatcher
+	return fileWatcher, nil
+}
+
+func (fileWatcher *FileWatcher) handleEvent(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	fileWatcher.mutex.Lock()
+	defer fileWatcher.mutex.Unlock()
+	if entries, ok := fileWatcher.watchables[event.Name]; ok && !event.Has(fsnotify.Write) {
+		// The watched directory itself was created, removed or renamed
+		// (e.g. swapped by a deployment), which requires a new watch.
+		if event.Has(fsnotify.Create) {
+			if err := fileWatcher.watcher.Add(event.Name); err != nil {
+				slog.Warn("Failed to watch directory", "path", event.Name, "error", err)
+			}
+		}
+		for _, entry := range entries {
+			entry.schedule(fileWatcher.debounce)
+		}
+	}
+
+	name := path.Base(event.Name)
+	for _, entry := range fileWatcher.watchables[path.Dir(event.Name)] {
+		if entry.matches(name) {
+			entry.schedule(fileWatcher.debounce)
+		}
+	}
 }
 
-func (fileWatcher FileWatcher) Watch(watchable WatchableFile) error {
+// Watch registers the watchable. Its directory is watched, as files are
+// often replaced instead of written. A missing directory is watched once it
+// is created, which requires a watch of its parent directory. An error is
+// only returned, if neither can be watched.
+func (fileWatcher *FileWatcher) Watch(watchable WatchableFile) error {
+	fileWatcher.mutex.Lock()
+	defer fileWatcher.mutex.Unlock()
 	dir := watchable.Dir()
-	watchables, ok := fileWatcher.watchables[watchable.Dir()]
-	if ok {
-		fileWatcher.watchables[watchable.Dir()] = append(watchables, watchable)
+	entry := &watchEntry{watchable: watchable}
+	if entries, ok := fileWatcher.watchables[dir]; ok {
+		fileWatcher.watchables[dir] = append(entries, entry)
+		return nil
+	}
+
+	fileWatcher.watchables[dir] = []*watchEntry{entry}
+	if parent := path.Dir(dir); parent != dir && !fileWatcher.parents[parent] {
+		if err := fileWatcher.watcher.Add(parent); err == nil {
+			fileWatcher.parents[parent] = true
+		}
+	}
+	err := fileWatcher.watcher.Add(dir)
+	if errors.Is(err, fs.ErrNotExist) && fileWatcher.parents[path.Dir(dir)] {
 		return nil
-	} else {
-		fileWatcher.watchables[watchable.Dir()] = []WatchableFile{watchable}
-		return fileWatcher.watcher.Add(dir)
 	}
+	return err
 }
 
-func (fileWatcher FileWatcher) Close() error {
-	if fileWatcher.watcher == nil {
+func (fileWatcher *FileWatcher) Close() error {
+	if fileWatcher == nil || fileWatcher.watcher == nil {
 		return nil
 	}
+
+	fileWatcher.mutex.Lock()
+	for _, entries := range fileWatcher.watchables {
+		for _, entry := range entries {
+			entry.stop()
+		}
+	}
+	fileWatcher.mutex.Unlock()
 	return fileWatcher.watcher.Close()
 }
+
+// matches returns whether a change of the file with the given name in the
+// directory of the watchable concerns it. Besides the file itself, the swap
+// of the ..data symlink, through which the files of a Kubernetes volume are
+// linked, does.
+func (entry *watchEntry) matches(name string) bool {
+	if watchableDir, ok := entry.watchable.(WatchableDir); ok {
+		return watchableDir.Matches(name)
+	}
+
+	return name == entry.watchable.Name() || name == dataLink
+}
+
+func (entry *watchEntry) schedule(debounce time.Duration) {
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	entry.timer = time.AfterFunc(debounce, func() {
+		entry.handling.Lock()
+		defer entry.handling.Unlock()
+		entry.watchable.HandleChange()
+	})
+}
+
+func (entry *watchEntry) stop() {
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+}
@@ -4,34 +4,68 @@ import (
 	"ngstaticserver/test"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 type testEnvState struct {
-	env map[string]*string
+	mutex sync.Mutex
+	env   map[string]*string
 }
 
 func (env *testEnvState) handleChange(variables map[string]*string) {
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
 	env.env = variables
 }
 
+func (env *testEnvState) variables() map[string]*string {
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
+	return env.env
+}
+
+// countingFile is a WatchableFile, which counts its changes.
+type countingFile struct {
+	path    string
+	changes *atomic.Int32
+}
+
+func (file countingFile) Dir() string {
+	return filepath.Dir(file.path)
+}
+
+func (file countingFile) Name() string {
+	return filepath.Base(file.path)
+}
+
+func (file countingFile) HandleChange() {
+	file.changes.Add(1)
+}
+
+// watchModes are the backends, which the event patterns are tested with.
+var watchModes = []WatchOptions{
+	{Mode: WatchModeInotify},
+	{Mode: WatchModePoll, Interval: time.Millisecond * 5},
+}
+
 func TestShouldUpdateDotEnvOnChange(t *testing.T) {
 	context := test.NewTestDir(t)
 	envFilePath := filepath.Join(context.Path, "../config/.env")
 	os.WriteFile(envFilePath, []byte("ENV =production\nPORT =8080 \nDELAY = 200"), 0666)
 
-	fileWatcher := CreateFileWatcher()
+	fileWatcher := createFileWatcher(t, WatchOptions{Mode: WatchModeInotify})
 	test.AssertTrue(t, fileWatcher.watcher != nil)
-	t.Cleanup(func() {
-		fileWatcher.Close()
-	})
-	testEnv := &testEnvState{make(map[string]*string)}
+	testEnv := &testEnvState{env: make(map[string]*string)}
 	env := CreateDotEnv(context.Path, testEnv.handleChange)
 	err := fileWatcher.Watch(env)
 	test.AssertNoError(t, err)
 
-	test.AssertEqual(t, len(testEnv.env), 3)
+	test.AssertEqual(t, len(testEnv.variables()), 3)
 
 	err = os.WriteFile(envFilePath, []byte("TEST = example"), 0666)
 	if err != nil {
@@ -40,6 +74,212 @@ func TestShouldUpdateDotEnvOnChange(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 50)
 
-	test.AssertEqual(t, len(testEnv.env), 1)
-	test.AssertEqual(t, readValue(t, testEnv.env, "TEST"), "example")
+	test.AssertEqual(t, len(testEnv.variables()), 1)
+	test.AssertEqual(t, readValue(t, testEnv.variables(), "TEST"), "example")
+}
+
+func TestShouldHandleRepeatedWrites(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			fileWatcher, changes := watchCountingFiles(t, options, context.Join("a.txt"))
+
+			for i := 0; i < 3; i++ {
+				context.WriteFile("a.txt", "first")
+				time.Sleep(time.Millisecond * 50)
+				test.AssertEqual(t, changes[0].Load(), int32(i+1))
+			}
+			test.AssertNoError(t, fileWatcher.Close())
+		})
+	}
+}
+
+func TestShouldDebounceWritesPerFile(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			_, changes := watchCountingFiles(t, options, context.Join("a.txt"), context.Join("b.txt"))
+
+			for i := 0; i < 5; i++ {
+				context.WriteFile("a.txt", "content")
+			}
+			context.WriteFile("b.txt", "content")
+			time.Sleep(time.Millisecond * 50)
+
+			test.AssertEqual(t, changes[0].Load(), int32(1))
+			test.AssertEqual(t, changes[1].Load(), int32(1))
+		})
+	}
+}
+
+// The event loop must keep running after an event, which concerns another
+// file or only some of the files in a directory.
+func TestShouldKeepWatchingAfterEvents(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			_, changes := watchCountingFiles(t, options, context.Join("a.txt"), context.Join("b.txt"))
+
+			context.WriteFile("other.txt", "content")
+			time.Sleep(time.Millisecond * 50)
+			context.WriteFile("b.txt", "content")
+			time.Sleep(time.Millisecond * 50)
+			context.WriteFile("a.txt", "content")
+			time.Sleep(time.Millisecond * 50)
+
+			test.AssertEqual(t, changes[0].Load(), int32(1))
+			test.AssertEqual(t, changes[1].Load(), int32(1))
+		})
+	}
+}
+
+func TestShouldHandleAtomicRename(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			context.WriteFile("a.txt", "first")
+			_, changes := watchCountingFiles(t, options, context.Join("a.txt"), context.Join("b.txt"))
+
+			context.WriteFile("a.txt.tmp", "second")
+			test.AssertNoError(t, os.Rename(context.Join("a.txt.tmp"), context.Join("a.txt")))
+			time.Sleep(time.Millisecond * 50)
+
+			test.AssertEqual(t, changes[0].Load(), int32(1))
+			test.AssertEqual(t, changes[1].Load(), int32(0))
+		})
+	}
+}
+
+func TestShouldHandleRemoveAndCreate(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			context.WriteFile("a.txt", "first")
+			_, changes := watchCountingFiles(t, options, context.Join("a.txt"))
+
+			test.AssertNoError(t, os.Remove(context.Join("a.txt")))
+			time.Sleep(time.Millisecond * 50)
+			test.AssertEqual(t, changes[0].Load(), int32(1))
+
+			context.WriteFile("a.txt", "second")
+			time.Sleep(time.Millisecond * 50)
+			test.AssertEqual(t, changes[0].Load(), int32(2))
+		})
+	}
+}
+
+func TestShouldHandleSymlinkSwap(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			writeConfigMapData(t, context, "..2024_01", "first")
+			test.AssertNoError(t, os.Symlink("..2024_01", context.Join("..data")))
+			test.AssertNoError(t, os.Symlink("..data/LABEL", context.Join("LABEL")))
+			_, changes := watchCountingFiles(t, options, context.Join("LABEL"))
+
+			writeConfigMapData(t, context, "..2024_02", "second")
+			test.AssertNoError(t, os.Symlink("..2024_02", context.Join("..data_tmp")))
+			test.AssertNoError(t, os.Rename(context.Join("..data_tmp"), context.Join("..data")))
+			test.AssertNoError(t, os.RemoveAll(context.Join("..2024_01")))
+			time.Sleep(time.Millisecond * 50)
+
+			test.AssertEqual(t, changes[0].Load(), int32(1))
+		})
+	}
+}
+
+func TestShouldHandleDirectorySwap(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			dir := context.Join("config")
+			test.AssertNoError(t, os.Mkdir(dir, 0755))
+			test.AssertNoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("first"), 0644))
+			_, changes := watchCountingFiles(t, options, filepath.Join(dir, "a.txt"))
+
+			test.AssertNoError(t, os.RemoveAll(dir))
+			test.AssertNoError(t, os.Mkdir(dir, 0755))
+			test.AssertNoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("second"), 0644))
+			time.Sleep(time.Millisecond * 50)
+			current := changes[0].Load()
+			test.AssertTrue(t, current >= 1)
+
+			// The new directory is watched.
+			test.AssertNoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("third"), 0644))
+			time.Sleep(time.Millisecond * 50)
+			test.AssertEqual(t, changes[0].Load(), current+1)
+		})
+	}
+}
+
+func TestShouldWatchMissingDirectoryOnceCreated(t *testing.T) {
+	for _, options := range watchModes {
+		t.Run(options.Mode, func(t *testing.T) {
+			context := test.NewTestDir(t)
+			dir := context.Join("config")
+			fileWatcher := createFileWatcher(t, options)
+			changes := &atomic.Int32{}
+			test.AssertNoError(t, fileWatcher.Watch(countingFile{filepath.Join(dir, "a.txt"), changes}))
+
+			test.AssertNoError(t, os.Mkdir(dir, 0755))
+			time.Sleep(time.Millisecond * 50)
+			test.AssertNoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("first"), 0644))
+			time.Sleep(time.Millisecond * 50)
+
+			test.AssertTrue(t, changes.Load() >= 1)
+		})
+	}
+}
+
+// inotify reports a modification of a watched directory as Write event of
+// the directory in its parent, which must not be handled like a swap of the
+// directory.
+func TestShouldHandleDirectoryEventsExceptWrites(t *testing.T) {
+	context := test.NewTestDir(t)
+	dir := context.Join("config")
+	test.AssertNoError(t, os.Mkdir(dir, 0755))
+	fileWatcher, changes := watchCountingFiles(t, WatchOptions{Mode: WatchModeInotify}, filepath.Join(dir, "a.txt"))
+
+	fileWatcher.handleEvent(fsnotify.Event{Name: dir, Op: fsnotify.Write})
+	fileWatcher.handleEvent(fsnotify.Event{Name: dir, Op: fsnotify.Chmod})
+	time.Sleep(time.Millisecond * 50)
+	test.AssertEqual(t, changes[0].Load(), int32(0))
+
+	for i, op := range []fsnotify.Op{fsnotify.Remove, fsnotify.Create, fsnotify.Rename} {
+		fileWatcher.handleEvent(fsnotify.Event{Name: dir, Op: op})
+		time.Sleep(time.Millisecond * 50)
+		test.AssertEqual(t, changes[0].Load(), int32(i+1))
+	}
+}
+
+func watchCountingFiles(t *testing.T, options WatchOptions, filePaths ...string) (*FileWatcher, []*atomic.Int32) {
+	t.Helper()
+	fileWatcher := createFileWatcher(t, options)
+	changes := make([]*atomic.Int32, len(filePaths))
+	for i, filePath := range filePaths {
+		changes[i] = &atomic.Int32{}
+		test.AssertNoError(t, fileWatcher.Watch(countingFile{filePath, changes[i]}))
+	}
+	return fileWatcher, changes
+}
+
+func TestShouldNotWatchWhenOff(t *testing.T) {
+	context := test.NewTestDir(t)
+	fileWatcher, changes := watchCountingFiles(t, WatchOptions{Mode: WatchModeOff}, context.Join("a.txt"))
+
+	context.WriteFile("a.txt", "first")
+	time.Sleep(time.Millisecond * 50)
+
+	test.AssertEqual(t, changes[0].Load(), int32(0))
+	test.AssertNoError(t, fileWatcher.Close())
+}
+
+func createFileWatcher(t *testing.T, options WatchOptions) *FileWatcher {
+	t.Helper()
+	fileWatcher, err := CreateFileWatcher(options)
+	test.AssertNoError(t, err)
+	t.Cleanup(func() {
+		fileWatcher.Close()
+	})
+	return fileWatcher
 }
@@ -0,0 +1,90 @@
+package config
+
+import "sync"
+
+// LocaleVariables are the app variables of a locale in an i18n build. The
+// variables of the .env.<locale> overlay are merged on top of the variables
+// of the global .env file.
+type LocaleVariables struct {
+	Locale       string
+	AppVariables *AppVariables
+	mutex        sync.Mutex
+	global       map[string]*string
+	overlay      map[string]*string
+}
+
+// NewLocaleVariables creates the variables of a locale with the
+// configuration of the ngssc.json, which applies to its index.html. Without
+// a base, the locale has no app variables.
+func NewLocaleVariables(locale string, base *AppVariables) *LocaleVariables {
+	return &LocaleVariables{
+		Locale:       locale,
+		AppVariables: newLocaleAppVariables(base),
+		global:       make(map[string]*string),
+		overlay:      make(map[string]*string),
+	}
+}
+
+func newLocaleAppVariables(base *AppVariables) *AppVariables {
+	if base == nil {
+		return nil
+	}
+
+	appVariables := newAppVariables(
+		base.Variant, base.EnvironmentVariables, populateEnvironmentVariables(base.EnvironmentVariables, nil))
+	appVariables.Dir = base.Dir
+	appVariables.FilePattern = base.FilePattern
+	appVariables.Public = base.Public
+	return appVariables
+}
+
+// Rebase replaces the app variables, if the configuration of the base
+// changed (e.g. by a changed ngssc.json), and merges the current variables
+// into them.
+func (localeVariables *LocaleVariables) Rebase(base *AppVariables) {
+	localeVariables.mutex.Lock()
+	defer localeVariables.mutex.Unlock()
+	if base == nil {
+		localeVariables.AppVariables = nil
+	} else if !base.HasSameConfiguration(localeVariables.AppVariables) {
+		localeVariables.AppVariables = newLocaleAppVariables(base)
+		localeVariables.merge()
+	}
+}
+
+// MergeGlobal is called with the variables of the global .env file.
+func (localeVariables *LocaleVariables) MergeGlobal(variables map[string]*string) {
+	localeVariables.mutex.Lock()
+	defer localeVariables.mutex.Unlock()
+	localeVariables.global = variables
+	localeVariables.merge()
+}
+
+// MergeOverlay is called with the variables of the .env.<locale> file.
+func (localeVariables *LocaleVariables) MergeOverlay(variables map[string]*string) {
+	localeVariables.mutex.Lock()
+	defer localeVariables.mutex.Unlock()
+	localeVariables.overlay = variables
+	localeVariables.merge()
+}
+
+// Overlay returns the variables of the .env.<locale> file.
+func (localeVariables *LocaleVariables) Overlay() map[string]*string {
+	localeVariables.mutex.Lock()
+	defer localeVariables.mutex.Unlock()
+	return localeVariables.overlay
+}
+
+func (localeVariables *LocaleVariables) merge() {
+	if localeVariables.AppVariables == nil {
+		return
+	}
+	merged := make(map[string]*string, len(localeVariables.global)+len(localeVariables.overlay))
+	for k, v := range localeVariables.global {
+		merged[k] = v
+	}
+	for k, v := range localeVariables.overlay {
+		merged[k] = v
+	}
+	localeVariables.AppVariables.MergeVariables(merged)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocaleVariablesOverlay(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	context.WriteFile(".env", "PHONE=+41 00 000 00 00\nREGION=eu")
+	context.WriteFile(".env.fr", "PHONE=+33 0 00 00 00 00")
+
+	localeVariables := NewLocaleVariables("fr", DefaultAppVariables())
+	CreateDotEnv(context.Path, localeVariables.MergeGlobal)
+	CreateLocaleDotEnv(context.Path, "fr", localeVariables.MergeOverlay)
+
+	content, _ := localeVariables.AppVariables.Insert([]byte("<!--CONFIG-->"), false)
+	test.AssertEqual(t, string(content), `<script>(function(self){Object.assign(self,{"PHONE":"+33 0 00 00 00 00","REGION":"eu"});})(window)</script>`)
+}
+
+func TestLocaleVariablesNgsscJson(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	context.WriteFile("de-CH/ngssc.json", `{"variant":"NG_ENV","environmentVariables":["PHONE","REGION"]}`)
+	base, err := ReadNgsscJson(filepath.Join(context.Path, "de-CH/ngssc.json"))
+	test.AssertNoError(t, err)
+
+	localeVariables := NewLocaleVariables("de-CH", base)
+	value := "eu"
+	localeVariables.MergeOverlay(map[string]*string{"REGION": &value, "OTHER": &value})
+
+	test.AssertEqual(t, localeVariables.AppVariables.Variant, "NG_ENV")
+	test.AssertEqual(t, localeVariables.AppVariables.Dir, base.Dir)
+	test.AssertTrue(t, localeVariables.AppVariables.Has("REGION"))
+	test.AssertTrue(t, !localeVariables.AppVariables.Has("OTHER"))
+	test.AssertTrue(t, base.Snapshot().Variables["REGION"] == nil)
+}
+
+func TestLocaleVariablesRebase(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	context.WriteFile("de-CH/ngssc.json", `{"variant":"NG_ENV","environmentVariables":["REGION"]}`)
+	base, err := ReadNgsscJson(filepath.Join(context.Path, "de-CH/ngssc.json"))
+	test.AssertNoError(t, err)
+
+	localeVariables := NewLocaleVariables("de-CH", base)
+	value := "eu"
+	localeVariables.MergeOverlay(map[string]*string{"REGION": &value, "PHONE": &value})
+	previous := localeVariables.AppVariables
+
+	context.WriteFile("de-CH/ngssc.json", `{"variant":"NG_ENV","environmentVariables":["REGION"]}`)
+	unchanged, err := ReadNgsscJson(filepath.Join(context.Path, "de-CH/ngssc.json"))
+	test.AssertNoError(t, err)
+	localeVariables.Rebase(unchanged)
+	test.AssertTrue(t, localeVariables.AppVariables == previous)
+
+	context.WriteFile("de-CH/ngssc.json", `{"variant":"global","environmentVariables":["REGION","PHONE"]}`)
+	changed, err := ReadNgsscJson(filepath.Join(context.Path, "de-CH/ngssc.json"))
+	test.AssertNoError(t, err)
+	localeVariables.Rebase(changed)
+	test.AssertEqual(t, localeVariables.AppVariables.Variant, "global")
+	test.AssertTrue(t, localeVariables.AppVariables.Has("PHONE"))
+
+	localeVariables.Rebase(nil)
+	test.AssertTrue(t, localeVariables.AppVariables == nil)
+	localeVariables.MergeOverlay(map[string]*string{})
+}
+
+func TestLocaleDotEnvInConfigDirectory(t *testing.T) {
+	context := test.NewTestDir(t)
+	err := os.WriteFile(filepath.Join(context.Path, "../config/.env.fr"), []byte("REGION=eu-west"), 0644)
+	test.AssertNoError(t, err)
+	context.WriteFile(".env.fr", "REGION=ignored")
+
+	var result map[string]*string
+	dotEnv := CreateLocaleDotEnv(context.Path, "fr", func(variables map[string]*string) {
+		result = variables
+	})
+
+	test.AssertEqual(t, readValue(t, result, "REGION"), "eu-west")
+	test.AssertTrue(t, strings.HasSuffix(dotEnv.Dir(), "config"))
+	test.AssertEqual(t, dotEnv.Name(), ".env.fr")
+}
+
+func TestMissingLocaleDotEnv(t *testing.T) {
+	context := test.NewTestDir(t)
+
+	var result map[string]*string
+	CreateLocaleDotEnv(context.Path, "fr", func(variables map[string]*string) {
+		result = variables
+	})
+
+	test.AssertEqual(t, len(result), 0)
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFilePattern is used, if an ngssc.json does not define a filePattern,
+// and matches the index.html in the directory of the ngssc.json and in
+// every subdirectory.
+const DefaultFilePattern = "**/index.html"
+
+// ngsscJSON corresponds to the relevant JSON structure of ngssc.json
+// (https://github.com/kyubisation/angular-server-side-configuration).
+type ngsscJSON struct {
+	Variant              *string
+	EnvironmentVariables []string
+	FilePattern          *string
+}
+
+// DiscoverAppVariables reads every ngssc.json in the working directory, e.g.
+// the ngssc.json of each app of a multi-project or i18n build.
+func DiscoverAppVariables(root string) ([]*AppVariables, error) {
+	result := make([]*AppVariables, 0)
+	errs := make([]error, 0)
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || entry.Name() != "ngssc.json" {
+			return err
+		}
+		appVariables, err := ReadNgsscJson(filePath)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			result = append(result, appVariables)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// ReadNgsscJson reads and validates an ngssc.json file.
+func ReadNgsscJson(filePath string) (*AppVariables, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %w", filePath, err)
+	}
+
+	slog.Info(fmt.Sprintf("Detected ngssc.json file at %v. Reading configuration.", filePath))
+	ngssc, err := parseNgsscJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ngssc.json at %v (%v)", filePath, err)
+	}
+
+	filePattern := DefaultFilePattern
+	if ngssc.FilePattern != nil {
+		filePattern = *ngssc.FilePattern
+	}
+	appVariables := newAppVariables(
+		*ngssc.Variant, ngssc.EnvironmentVariables, populateEnvironmentVariables(ngssc.EnvironmentVariables, nil))
+	appVariables.Dir = filepath.Dir(filePath)
+	appVariables.FilePattern = filePattern
+	return appVariables, nil
+}
+
+func parseNgsscJson(data []byte) (*ngsscJSON, error) {
+	var ngssc *ngsscJSON
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("must not be empty")
+	} else if err := json.Unmarshal(data, &ngssc); err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &syntaxError) {
+			return nil, fmt.Errorf("%v at %v", syntaxError, position(data, syntaxError.Offset))
+		} else if errors.As(err, &typeError) && len(typeError.Field) > 0 {
+			field, index, isElement := strings.Cut(typeError.Field, ".")
+			if isElement {
+				return nil, fmt.Errorf("%v[%v] must be a string at %v", field, index, position(data, typeError.Offset))
+			}
+			return nil, fmt.Errorf("%v must be %v at %v", field, describeField(field), position(data, typeError.Offset))
+		} else if errors.As(err, &typeError) {
+			return nil, fmt.Errorf("must be a JSON object")
+		}
+		return nil, err
+	} else if ngssc == nil {
+		return nil, fmt.Errorf("must not be empty")
+	}
+
+	if ngssc.Variant == nil {
+		return nil, fmt.Errorf("variant must be defined (process, NG_ENV or global)")
+	} else if *ngssc.Variant != "process" && *ngssc.Variant != "global" && *ngssc.Variant != "NG_ENV" {
+		return nil, fmt.Errorf("variant must either be process, NG_ENV or global, got %q", *ngssc.Variant)
+	} else if ngssc.EnvironmentVariables == nil {
+		return nil, fmt.Errorf("environmentVariables must be defined")
+	}
+	defined := make(map[string]bool)
+	for i, name := range ngssc.EnvironmentVariables {
+		if len(strings.TrimSpace(name)) == 0 {
+			return nil, fmt.Errorf("environmentVariables[%v] must not be empty", i)
+		} else if defined[name] {
+			return nil, fmt.Errorf("environmentVariables[%v] %v is defined multiple times", i, name)
+		} else if _, err := compileVariablePattern(name); err != nil {
+			return nil, fmt.Errorf("environmentVariables[%v] %v is not a valid regular expression: %v", i, name, err)
+		}
+		defined[name] = true
+	}
+	if ngssc.FilePattern != nil {
+		filePattern := *ngssc.FilePattern
+		if len(filePattern) == 0 {
+			return nil, fmt.Errorf("filePattern must not be empty")
+		} else if path.IsAbs(filePattern) || filepath.IsAbs(filePattern) {
+			return nil, fmt.Errorf("filePattern must be relative to the ngssc.json, got %v", filePattern)
+		} else if strings.Contains("/"+filePattern+"/", "/../") {
+			return nil, fmt.Errorf("filePattern must not leave the directory of the ngssc.json, got %v", filePattern)
+		}
+	}
+
+	return ngssc, nil
+}
+
+func describeField(field string) string {
+	if field == "environmentVariables" {
+		return "an array of strings"
+	}
+	return "a string"
+}
+
+// position converts the offset after an invalid token, as reported by
+// encoding/json, into the line and column of the last character of the token.
+func position(data []byte, offset int64) string {
+	offset = max(min(offset-1, int64(len(data))), 0)
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %v, column %v", line, column)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadNgsscJsonFilePattern(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile("ngssc.json", `{"variant":"process","environmentVariables":["LABEL"],"filePattern":"**/*.html"}`)
+	appVariables, err := ReadNgsscJson(filepath.Join(context.Path, "ngssc.json"))
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, appVariables.FilePattern, "**/*.html")
+	test.AssertEqual(t, appVariables.Dir, context.Path)
+
+	context.WriteFile("ngssc.json", `{"variant":"process","environmentVariables":[]}`)
+	appVariables, err = ReadNgsscJson(filepath.Join(context.Path, "ngssc.json"))
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, appVariables.FilePattern, DefaultFilePattern)
+}
+
+func TestReadNgsscJsonValidation(t *testing.T) {
+	context := test.NewTestDir(t)
+	for content, expected := range map[string]string{
+		` `:                                   "must not be empty",
+		`null`:                                "must not be empty",
+		`[]`:                                  "must be a JSON object",
+		"{\n  \"variant\": \"process\",\n  }": "invalid character '}' looking for beginning of object key string at line 3, column 3",
+		`{"environmentVariables":[]}`:         "variant must be defined (process, NG_ENV or global)",
+		`{"variant":"env","environmentVariables":[]}`:                         `variant must either be process, NG_ENV or global, got "env"`,
+		`{"variant":"global"}`:                                                "environmentVariables must be defined",
+		`{"variant":"global","environmentVariables":"LABEL"}`:                 "environmentVariables must be an array of strings at line 1, column 50",
+		`{"variant":"global","environmentVariables":["LABEL",1]}`:             "environmentVariables[1] must be a string at line 1, column 53",
+		`{"variant":"global","environmentVariables":["LABEL",""]}`:            "environmentVariables[1] must not be empty",
+		`{"variant":"global","environmentVariables":["LABEL","LABEL"]}`:       "environmentVariables[1] LABEL is defined multiple times",
+		`{"variant":"global","environmentVariables":["/(/"]}`:                 "environmentVariables[0] /(/ is not a valid regular expression: error parsing regexp: missing closing ): `(`",
+		`{"variant":"global","environmentVariables":[],"filePattern":1}`:      "filePattern must be a string at line 1, column 61",
+		`{"variant":"global","environmentVariables":[],"filePattern":"/a"}`:   "filePattern must be relative to the ngssc.json, got /a",
+		`{"variant":"global","environmentVariables":[],"filePattern":"../a"}`: "filePattern must not leave the directory of the ngssc.json, got ../a",
+	} {
+		context.WriteFile("ngssc.json", content)
+		_, err := ReadNgsscJson(filepath.Join(context.Path, "ngssc.json"))
+		if err == nil {
+			t.Errorf("Expected an error for %v", content)
+		} else {
+			test.AssertTrue(t, strings.HasPrefix(err.Error(), "invalid ngssc.json at "))
+			test.AssertEqual(t, strings.TrimSuffix(strings.SplitN(err.Error(), " (", 2)[1], ")"), expected)
+		}
+	}
+}
+
+func TestDiscoverAppVariables(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	context.WriteFile("ngssc.json", `{"variant":"global","environmentVariables":["LABEL"]}`)
+	context.WriteFile("fr/ngssc.json", `{"variant":"NG_ENV","environmentVariables":["LABEL"]}`)
+
+	appVariables, err := DiscoverAppVariables(context.Path)
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, len(appVariables), 2)
+
+	context.WriteFile("de-CH/ngssc.json", `{"variant":"NG_ENV"}`)
+	_, err = DiscoverAppVariables(context.Path)
+	test.AssertTrue(t, err != nil && strings.Contains(err.Error(), "de-CH"))
+
+	_, err = DiscoverAppVariables(filepath.Join(context.Path, "missing"))
+	test.AssertNoError(t, err)
+}
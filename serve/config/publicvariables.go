@@ -0,0 +1,42 @@
+package config
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PublicVariables is the exposure policy for the variables of the .env files,
+// if there is no ngssc.json. Only variables starting with the prefix or
+// contained in the names are inserted into the HTML files.
+type PublicVariables struct {
+	Prefix string
+	Names  []string
+}
+
+// IsDefined returns whether a prefix or names are configured. Without a
+// policy, no variable is public.
+func (public PublicVariables) IsDefined() bool {
+	return len(public.Prefix) > 0 || len(public.Names) > 0
+}
+
+func (public PublicVariables) IsPublic(name string) bool {
+	return (len(public.Prefix) > 0 && strings.HasPrefix(name, public.Prefix)) ||
+		slices.Contains(public.Names, name)
+}
+
+// Filter returns the public variables and the sorted names of the skipped
+// variables.
+func (public PublicVariables) Filter(variables map[string]*string) (map[string]*string, []string) {
+	result := make(map[string]*string, len(variables))
+	skipped := make([]string, 0)
+	for name, value := range variables {
+		if public.IsPublic(name) {
+			result[name] = value
+		} else {
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	return result, skipped
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"maps"
+	"sync"
+)
+
+// VariableSources combines the variables of several sources (e.g. the .env
+// file and the config directory), where later sources override the
+// variables of earlier sources.
+type VariableSources struct {
+	mutex    sync.Mutex
+	sources  []map[string]*string
+	onChange func(variables map[string]*string)
+}
+
+func NewVariableSources(count int, onChange func(variables map[string]*string)) *VariableSources {
+	return &VariableSources{sources: make([]map[string]*string, count), onChange: onChange}
+}
+
+// Source returns the callback for the source at the given index, which
+// replaces its variables and calls onChange with the combined variables.
+func (variableSources *VariableSources) Source(index int) func(variables map[string]*string) {
+	return func(variables map[string]*string) {
+		variableSources.mutex.Lock()
+		defer variableSources.mutex.Unlock()
+		variableSources.sources[index] = variables
+		merged := make(map[string]*string)
+		for _, source := range variableSources.sources {
+			maps.Copy(merged, source)
+		}
+		variableSources.onChange(merged)
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"testing"
+)
+
+func TestVariableSources(t *testing.T) {
+	var result map[string]*string
+	sources := NewVariableSources(2, func(variables map[string]*string) {
+		result = variables
+	})
+	first, second, third := "first", "second", "third"
+	sources.Source(1)(map[string]*string{"LABEL": &second})
+	sources.Source(0)(map[string]*string{"LABEL": &first, "REGION": &third})
+	test.AssertEqual(t, readValue(t, result, "LABEL"), "second")
+	test.AssertEqual(t, readValue(t, result, "REGION"), "third")
+
+	sources.Source(1)(map[string]*string{})
+	test.AssertEqual(t, readValue(t, result, "LABEL"), "first")
+}
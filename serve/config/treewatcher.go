@@ -0,0 +1,109 @@
+package config
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// TreeWatcher watches a directory and all of its subdirectories and calls
+// onChange once a burst of changes has settled for the debounce duration.
+type TreeWatcher struct {
+	watcher  watchBackend
+	root     string
+	debounce time.Duration
+	onChange func()
+	mutex    sync.Mutex
+	timer    *time.Timer
+}
+
+func CreateTreeWatcher(root string, debounce time.Duration, options WatchOptions, onChange func()) (*TreeWatcher, error) {
+	watcher, err := createWatchBackend(options)
+	if err != nil {
+		return nil, err
+	}
+
+	treeWatcher := &TreeWatcher{
+		watcher:  watcher,
+		root:     root,
+		debounce: debounce,
+		onChange: onChange,
+	}
+	err = treeWatcher.addDirectories(root)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events():
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					// Directories created after startup (e.g. by copying a new
+					// build into the tree) need their own watch.
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err := treeWatcher.addDirectories(event.Name); err != nil {
+							slog.Warn("Failed to watch directory", "path", event.Name, "error", err)
+						}
+					}
+				}
+				if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+					continue
+				}
+				treeWatcher.schedule()
+			case err, ok := <-watcher.Errors():
+				if !ok {
+					return
+				}
+				slog.Error("tree watcher encountered an error", "error", err)
+			}
+		}
+	}()
+
+	return treeWatcher, nil
+}
+
+func (treeWatcher *TreeWatcher) addDirectories(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		} else if !d.IsDir() {
+			return nil
+		}
+
+		return treeWatcher.watcher.Add(path)
+	})
+}
+
+func (treeWatcher *TreeWatcher) schedule() {
+	treeWatcher.mutex.Lock()
+	defer treeWatcher.mutex.Unlock()
+	if treeWatcher.timer != nil {
+		treeWatcher.timer.Stop()
+	}
+	treeWatcher.timer = time.AfterFunc(treeWatcher.debounce, treeWatcher.onChange)
+}
+
+func (treeWatcher *TreeWatcher) Close() error {
+	if treeWatcher == nil || treeWatcher.watcher == nil {
+		return nil
+	}
+	treeWatcher.mutex.Lock()
+	if treeWatcher.timer != nil {
+		treeWatcher.timer.Stop()
+	}
+	treeWatcher.mutex.Unlock()
+	return treeWatcher.watcher.Close()
+}
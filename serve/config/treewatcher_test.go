@@ -0,0 +1,74 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTreeWatcherDebouncesChanges(t *testing.T) {
+	context := test.NewTestDir(t)
+	var calls atomic.Int32
+	treeWatcher, err := CreateTreeWatcher(context.Path, time.Millisecond*50, WatchOptions{Mode: WatchModeInotify}, func() {
+		calls.Add(1)
+	})
+	test.AssertNoError(t, err)
+	t.Cleanup(func() {
+		treeWatcher.Close()
+	})
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		context.WriteFile(name, "example")
+	}
+	context.RemoveFile("b.txt")
+
+	time.Sleep(time.Millisecond * 200)
+
+	test.AssertEqual(t, calls.Load(), int32(1))
+}
+
+func TestTreeWatcherWatchesNewDirectories(t *testing.T) {
+	context := test.NewTestDir(t)
+	var calls atomic.Int32
+	treeWatcher, err := CreateTreeWatcher(context.Path, time.Millisecond*20, WatchOptions{Mode: WatchModeInotify}, func() {
+		calls.Add(1)
+	})
+	test.AssertNoError(t, err)
+	t.Cleanup(func() {
+		treeWatcher.Close()
+	})
+
+	err = os.Mkdir(filepath.Join(context.Path, "assets"), 0777)
+	test.AssertNoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	test.AssertEqual(t, calls.Load(), int32(1))
+
+	context.WriteFile("assets/logo.svg", "<svg></svg>")
+	time.Sleep(time.Millisecond * 100)
+	test.AssertEqual(t, calls.Load(), int32(2))
+}
+
+func TestTreeWatcherPolling(t *testing.T) {
+	context := test.NewTestDir(t)
+	var calls atomic.Int32
+	treeWatcher, err := CreateTreeWatcher(
+		context.Path, time.Millisecond*20, WatchOptions{Mode: WatchModePoll, Interval: time.Millisecond * 5}, func() {
+			calls.Add(1)
+		})
+	test.AssertNoError(t, err)
+	t.Cleanup(func() {
+		treeWatcher.Close()
+	})
+
+	err = os.Mkdir(filepath.Join(context.Path, "assets"), 0777)
+	test.AssertNoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	test.AssertEqual(t, calls.Load(), int32(1))
+
+	context.WriteFile("assets/logo.svg", "<svg></svg>")
+	time.Sleep(time.Millisecond * 100)
+	test.AssertEqual(t, calls.Load(), int32(2))
+}
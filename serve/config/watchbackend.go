@@ -0,0 +1,374 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// WatchModeAuto uses inotify and falls back to polling, if inotify is
+	// unavailable (e.g. when the inotify limits are exhausted).
+	WatchModeAuto    = "auto"
+	WatchModeInotify = "inotify"
+	// WatchModePoll compares the state of the watched directories in an
+	// interval, which also works on file systems without inotify support
+	// (e.g. NFS or some FUSE mounts).
+	WatchModePoll = "poll"
+	// WatchModeOff disables watching, so changes are only applied on restart.
+	WatchModeOff = "off"
+)
+
+// WatchOptions configures the backend of the FileWatcher and TreeWatcher.
+type WatchOptions struct {
+	Mode     string
+	Interval time.Duration
+}
+
+// watchBackend delivers the events of the watched directories.
+type watchBackend interface {
+	Add(dir string) error
+	Close() error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+}
+
+func ParseWatchMode(mode string) (string, error) {
+	switch mode {
+	case WatchModeAuto, WatchModeInotify, WatchModePoll, WatchModeOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("--watch-mode must be %v, %v, %v or %v, got %v",
+			WatchModeAuto, WatchModeInotify, WatchModePoll, WatchModeOff, mode)
+	}
+}
+
+func createWatchBackend(options WatchOptions) (watchBackend, error) {
+	switch options.Mode {
+	case WatchModePoll:
+		return newPollBackend(options.Interval), nil
+	case WatchModeOff:
+		return newNoopBackend(), nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil && options.Mode == WatchModeInotify {
+		return fsnotifyBackend{watcher}, nil
+	} else if err == nil {
+		return newAutoBackend(fsnotifyBackend{watcher}, options.Interval), nil
+	} else if options.Mode == WatchModeInotify {
+		return nil, fmt.Errorf("failed to create inotify watcher: %v", err)
+	}
+
+	slog.Warn(fmt.Sprintf("Failed to create inotify watcher. Falling back to polling every %v.", options.Interval), "error", err)
+	return newPollBackend(options.Interval), nil
+}
+
+type fsnotifyBackend struct {
+	watcher *fsnotify.Watcher
+}
+
+func (backend fsnotifyBackend) Add(dir string) error {
+	return backend.watcher.Add(dir)
+}
+
+func (backend fsnotifyBackend) Close() error {
+	return backend.watcher.Close()
+}
+
+func (backend fsnotifyBackend) Events() <-chan fsnotify.Event {
+	return backend.watcher.Events
+}
+
+func (backend fsnotifyBackend) Errors() <-chan error {
+	return backend.watcher.Errors
+}
+
+// autoBackend delivers the events of its primary backend (inotify) and
+// switches to polling, once the primary backend fails to watch a directory
+// because its limits are exhausted (e.g. fs.inotify.max_user_watches).
+type autoBackend struct {
+	interval time.Duration
+	// mutex guards current, polling, closed and dirs.
+	mutex      sync.Mutex
+	current    watchBackend
+	polling    bool
+	closed     bool
+	dirs       []string
+	events     chan fsnotify.Event
+	errors     chan error
+	forwarding sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+func newAutoBackend(primary watchBackend, interval time.Duration) *autoBackend {
+	backend := &autoBackend{
+		interval: interval,
+		current:  primary,
+		events:   make(chan fsnotify.Event),
+		errors:   make(chan error),
+	}
+	backend.forward(primary)
+	return backend
+}
+
+func (backend *autoBackend) Add(dir string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	err := backend.current.Add(dir)
+	if err != nil && !backend.polling && !backend.closed && isWatchLimitError(err) {
+		slog.Warn(fmt.Sprintf("Failed to watch %v with inotify. Falling back to polling every %v.", dir, backend.interval), "error", err)
+		err = backend.fallBack(dir)
+	}
+	if err == nil {
+		backend.dirs = append(backend.dirs, dir)
+	}
+	return err
+}
+
+// fallBack replaces the primary backend with a pollBackend, which watches
+// the directories watched so far and the given directory.
+func (backend *autoBackend) fallBack(dir string) error {
+	poll := newPollBackend(backend.interval)
+	for _, watched := range backend.dirs {
+		if err := poll.Add(watched); err != nil {
+			slog.Warn("Failed to watch directory", "path", watched, "error", err)
+		}
+	}
+	primary := backend.current
+	backend.current = poll
+	backend.polling = true
+	backend.forward(poll)
+	// The primary backend is closed asynchronously, as it might wait for its
+	// pending events to be received by the caller of Add.
+	go primary.Close()
+	return poll.Add(dir)
+}
+
+// forward delivers the events and errors of the source, until it is closed.
+func (backend *autoBackend) forward(source watchBackend) {
+	backend.forwarding.Add(1)
+	go func() {
+		defer backend.forwarding.Done()
+		events, errs := source.Events(), source.Errors()
+		for events != nil || errs != nil {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					events = nil
+				} else {
+					backend.events <- event
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+				} else {
+					backend.errors <- err
+				}
+			}
+		}
+	}()
+}
+
+func (backend *autoBackend) Close() error {
+	var err error
+	backend.closeOnce.Do(func() {
+		backend.mutex.Lock()
+		backend.closed = true
+		err = backend.current.Close()
+		backend.mutex.Unlock()
+		go func() {
+			backend.forwarding.Wait()
+			close(backend.events)
+			close(backend.errors)
+		}()
+	})
+	return err
+}
+
+func (backend *autoBackend) Events() <-chan fsnotify.Event {
+	return backend.events
+}
+
+func (backend *autoBackend) Errors() <-chan error {
+	return backend.errors
+}
+
+// isWatchLimitError returns whether the error results from exhausted inotify
+// watches (ENOSPC) or instances (EMFILE).
+func isWatchLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
+
+// noopBackend never delivers any events.
+type noopBackend struct {
+	events    chan fsnotify.Event
+	errors    chan error
+	closeOnce sync.Once
+}
+
+func newNoopBackend() *noopBackend {
+	return &noopBackend{events: make(chan fsnotify.Event), errors: make(chan error)}
+}
+
+func (backend *noopBackend) Add(dir string) error {
+	return nil
+}
+
+func (backend *noopBackend) Close() error {
+	backend.closeOnce.Do(func() {
+		close(backend.events)
+		close(backend.errors)
+	})
+	return nil
+}
+
+func (backend *noopBackend) Events() <-chan fsnotify.Event {
+	return backend.events
+}
+
+func (backend *noopBackend) Errors() <-chan error {
+	return backend.errors
+}
+
+// pollBackend stats the entries of the watched directories in an interval
+// and reports the differences to the previous state as events.
+type pollBackend struct {
+	interval  time.Duration
+	mutex     sync.Mutex
+	dirs      map[string]map[string]pollState
+	events    chan fsnotify.Event
+	errors    chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// pollState is the state of a directory entry. For a symlink the state of
+// its target is included, so that a change of the target is detected.
+type pollState struct {
+	mode          fs.FileMode
+	modTime       int64
+	size          int64
+	targetModTime int64
+	targetSize    int64
+}
+
+func newPollBackend(interval time.Duration) *pollBackend {
+	backend := &pollBackend{
+		interval: interval,
+		dirs:     make(map[string]map[string]pollState),
+		events:   make(chan fsnotify.Event, 64),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+	}
+	go backend.run()
+	return backend
+}
+
+func (backend *pollBackend) Add(dir string) error {
+	state, err := scanDir(dir)
+	if err != nil {
+		return err
+	}
+
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	backend.dirs[dir] = state
+	return nil
+}
+
+func (backend *pollBackend) Close() error {
+	backend.closeOnce.Do(func() {
+		close(backend.done)
+	})
+	return nil
+}
+
+func (backend *pollBackend) Events() <-chan fsnotify.Event {
+	return backend.events
+}
+
+func (backend *pollBackend) Errors() <-chan error {
+	return backend.errors
+}
+
+func (backend *pollBackend) run() {
+	defer close(backend.errors)
+	defer close(backend.events)
+	ticker := time.NewTicker(backend.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-backend.done:
+			return
+		case <-ticker.C:
+			for _, event := range backend.poll() {
+				select {
+				case backend.events <- event:
+				case <-backend.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// poll scans the watched directories and returns the events since the
+// previous scan. A removed directory results in a remove event for each of
+// its entries and is scanned again, once it is created.
+func (backend *pollBackend) poll() []fsnotify.Event {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	events := make([]fsnotify.Event, 0)
+	for dir, previous := range backend.dirs {
+		current, _ := scanDir(dir)
+		for name, state := range current {
+			if previousState, ok := previous[name]; !ok {
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Create})
+			} else if state != previousState {
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Write})
+			}
+		}
+		for name := range previous {
+			if _, ok := current[name]; !ok {
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+			}
+		}
+		backend.dirs[dir] = current
+	}
+
+	return events
+}
+
+func scanDir(dir string) (map[string]pollState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]pollState, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		state := pollState{mode: info.Mode(), modTime: info.ModTime().UnixNano(), size: info.Size()}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if target, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil {
+				state.targetModTime = target.ModTime().UnixNano()
+				state.targetSize = target.Size()
+			}
+		}
+		result[entry.Name()] = state
+	}
+
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// limitedBackend fails to watch more than limit directories like an inotify
+// watcher with exhausted watches.
+type limitedBackend struct {
+	*noopBackend
+	limit int
+	added int
+}
+
+func (backend *limitedBackend) Add(dir string) error {
+	if backend.added >= backend.limit {
+		return syscall.ENOSPC
+	}
+	backend.added++
+	return nil
+}
+
+func TestAutoBackendFallsBackToPolling(t *testing.T) {
+	context := test.NewTestDir(t)
+	for _, dir := range []string{"a", "b"} {
+		test.AssertNoError(t, os.Mkdir(context.Join(dir), 0755))
+		context.WriteFile(dir+"/"+dir+".txt", "first")
+	}
+	backend := newAutoBackend(&limitedBackend{noopBackend: newNoopBackend(), limit: 1}, time.Millisecond*5)
+	t.Cleanup(func() {
+		backend.Close()
+	})
+
+	test.AssertNoError(t, backend.Add(context.Join("a")))
+	test.AssertNoError(t, backend.Add(context.Join("b")))
+	test.AssertTrue(t, backend.polling)
+
+	// Directories added before and after the fallback are polled
+	time.Sleep(time.Millisecond * 20)
+	context.WriteFile("a/a.txt", "second content")
+	context.WriteFile("b/b.txt", "second content")
+	names := make(map[string]bool)
+	timeout := time.After(time.Second)
+	for len(names) < 2 {
+		select {
+		case event := <-backend.Events():
+			names[filepath.Base(event.Name)] = event.Has(fsnotify.Write)
+		case <-timeout:
+			t.Fatalf("expected events of both directories, got %v", names)
+		}
+	}
+	test.AssertTrue(t, names["a.txt"])
+	test.AssertTrue(t, names["b.txt"])
+}
+
+func TestAutoBackendKeepsOtherErrors(t *testing.T) {
+	context := test.NewTestDir(t)
+	backend, err := createWatchBackend(WatchOptions{Mode: WatchModeAuto, Interval: time.Millisecond * 5})
+	test.AssertNoError(t, err)
+	t.Cleanup(func() {
+		backend.Close()
+	})
+
+	test.AssertTrue(t, backend.Add(context.Join("missing")) != nil)
+	test.AssertTrue(t, !backend.(*autoBackend).polling)
+}
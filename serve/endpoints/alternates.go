@@ -0,0 +1,95 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"ngstaticserver/serve/headers"
+	"path/filepath"
+	"strings"
+)
+
+// Translation is a locale of an i18n build.
+type Translation struct {
+	// Prefix is the locale directory, or empty if the locale is served at
+	// unprefixed paths.
+	Prefix string
+	// Language is the language tag of the locale (e.g. de-CH).
+	Language string
+	// Host is the canonical host of the locale, if mapped (see HostLocales).
+	Host string
+}
+
+// LocaleAlternates announces the translations of a localized index.html via
+// hreflang Link headers (https://developers.google.com/search/docs/specialty/international/localized-versions)
+// and its language via the Content-Language header.
+type LocaleAlternates struct {
+	// Locale is the directory of the localized index.html.
+	Locale       string
+	Language     string
+	Translations []Translation
+	Origin       headers.Origin
+}
+
+// ResolveLocaleAlternates creates the alternates for every locale. The
+// language of a locale is read from the <html lang> attribute and falls
+// back to the directory name. If the default locale is served unprefixed,
+// its alternate links point to the unprefixed paths. If a locale is mapped to
+// a host, its alternate links point to that host.
+func ResolveLocaleAlternates(workingDirectory string, locales []string, unprefixedLocale string, origin headers.Origin, hosts *HostLocales) map[string]*LocaleAlternates {
+	translations := make([]Translation, 0, len(locales))
+	for _, locale := range locales {
+		language, err := readHtmlLang(filepath.Join(workingDirectory, locale, "index.html"))
+		if err != nil || !IsLanguageTag(language) {
+			language = locale
+		}
+		prefix := locale
+		if locale == unprefixedLocale {
+			prefix = ""
+		}
+		host, _ := hosts.CanonicalHost(locale)
+		translations = append(translations, Translation{prefix, language, host})
+	}
+
+	result := make(map[string]*LocaleAlternates)
+	for i, locale := range locales {
+		result[locale] = &LocaleAlternates{locale, translations[i].Language, translations, origin}
+	}
+
+	return result
+}
+
+// Apply sets the Content-Language header and a Link header for every
+// translation of the requested path, plus x-default for the unprefixed path,
+// which is either served by the default locale or redirected to the
+// matching locale.
+func (alternates *LocaleAlternates) Apply(w http.ResponseWriter, r *http.Request) {
+	if alternates == nil {
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	prefix := "/" + alternates.Locale
+	if path == prefix || strings.HasPrefix(path, prefix+"/") {
+		path = strings.TrimPrefix(path, prefix)
+	}
+	path = "/" + strings.TrimPrefix(path, "/")
+
+	origin := alternates.Origin.Resolve(r)
+	scheme, _, _ := strings.Cut(origin, "://")
+	links := make([]string, 0, len(alternates.Translations)+1)
+	for _, translation := range alternates.Translations {
+		href := origin
+		if len(translation.Host) > 0 {
+			href = scheme + "://" + translation.Host
+		}
+		if len(translation.Prefix) > 0 {
+			href += "/" + translation.Prefix
+		}
+		href += path
+		links = append(links, fmt.Sprintf(`<%v>; rel="alternate"; hreflang="%v"`, href, translation.Language))
+	}
+	links = append(links, fmt.Sprintf(`<%v>; rel="alternate"; hreflang="x-default"`, origin+path))
+
+	w.Header().Set("Content-Language", alternates.Language)
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,58 @@
+package endpoints
+
+import (
+	"net/http/httptest"
+	"ngstaticserver/serve/headers"
+	"ngstaticserver/test"
+	"testing"
+)
+
+func TestLocaleAlternates(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	alternates := ResolveLocaleAlternates(
+		context.Path, []string{"de-CH", "en-US", "fr"}, "", headers.Origin{Canonical: "https://example.com"}, nil)
+
+	req := httptest.NewRequest("GET", "/fr/products/42?ref=mail", nil)
+	w := httptest.NewRecorder()
+	alternates["fr"].Apply(w, req)
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.Header.Get("Content-Language"), "fr")
+	test.AssertEqual(
+		t,
+		resp.Header.Get("Link"),
+		`<https://example.com/de-CH/products/42>; rel="alternate"; hreflang="de-CH", `+
+			`<https://example.com/en-US/products/42>; rel="alternate"; hreflang="en-US", `+
+			`<https://example.com/fr/products/42>; rel="alternate"; hreflang="fr", `+
+			`<https://example.com/products/42>; rel="alternate"; hreflang="x-default"`)
+}
+
+func TestLocaleAlternates_unprefixedDefault(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	alternates := ResolveLocaleAlternates(context.Path, []string{"de-CH", "fr"}, "de-CH", headers.Origin{}, nil)
+
+	req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+	w := httptest.NewRecorder()
+	alternates["de-CH"].Apply(w, req)
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.Header.Get("Content-Language"), "de-CH")
+	test.AssertEqual(
+		t,
+		resp.Header.Get("Link"),
+		`<http://localhost:8080/>; rel="alternate"; hreflang="de-CH", `+
+			`<http://localhost:8080/fr/>; rel="alternate"; hreflang="fr", `+
+			`<http://localhost:8080/>; rel="alternate"; hreflang="x-default"`)
+}
+
+func TestLocaleAlternates_none(t *testing.T) {
+	var alternates *LocaleAlternates
+	w := httptest.NewRecorder()
+	alternates.Apply(w, httptest.NewRequest("GET", "/", nil))
+
+	test.AssertEqual(t, w.Result().Header.Get("Link"), "")
+}
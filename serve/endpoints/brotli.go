@@ -1,27 +0,0 @@
-package endpoints
-
-import (
-	"net/http"
-	"ngstaticserver/serve/headers"
-	"os"
-	"time"
-)
-
-type BrotliFileEndpoint struct {
-	Path         string
-	ModTime      time.Time
-	CacheControl string
-}
-
-func (endpoint BrotliFileEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
-	acceptedEncoding := headers.ResolveAcceptEncoding(r)
-	path := endpoint.Path
-	if acceptedEncoding.AllowsBrotli() {
-		path += ".br"
-		w.Header().Set("Content-Encoding", "br")
-	}
-	f, _ := os.Open(path)
-	defer f.Close()
-	w.Header().Set("Cache-Control", endpoint.CacheControl)
-	http.ServeContent(w, r, endpoint.Path, endpoint.ModTime, f)
-}
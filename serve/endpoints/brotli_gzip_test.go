@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/http/httptest"
+	"ngstaticserver/serve/headers"
 	"ngstaticserver/test"
 	"path/filepath"
 	"strings"
@@ -70,8 +71,58 @@ func TestFileRequestGzip_brotligzip(t *testing.T) {
 	test.AssertEqual(t, responseContent, content)
 }
 
+func TestFileRequestRemoved_brotligzip(t *testing.T) {
+	context, handler := createTestContext_brotligzip(t)
+	context.CompressFile(File)
+	context.RemoveFile(File + ".br")
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	req.Header.Add("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, 404)
+	test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "")
+}
+
 func createTestContext_brotligzip(t *testing.T) (test.TestDir, Endpoint) {
 	context := test.NewTestDir(t)
 	context.WriteFile(File, strings.Repeat("example", 10))
-	return context, BrotliGzipFileEndpoint{filepath.Join(context.Path, File), time.Now(), "no-store"}
+	return context, CompressedFileEndpoint{filepath.Join(context.Path, File), time.Now(), "no-store", nil, nil, headers.BROTLI | headers.GZIP, nil}
+}
+
+func TestFileRequestQuality_brotligzip(t *testing.T) {
+	context, handler := createTestContext_brotligzip(t)
+	context.CompressFile(File)
+	content := context.ReadFile(File)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	req.Header.Add("Accept-Encoding", "br;q=0.5, gzip;q=1.0, zstd;q=0")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "gzip")
+	test.AssertEqual(t, string(test.DecompressGzip(body)), content)
+}
+
+func TestFileRequestNotAcceptable_brotligzip(t *testing.T) {
+	context, handler := createTestContext_brotligzip(t)
+	context.CompressFile(File)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	req.Header.Add("Accept-Encoding", "zstd, identity;q=0")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, 406)
+	test.AssertEqual(t, resp.Header.Get("Vary"), "Accept-Encoding")
+	test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "")
 }
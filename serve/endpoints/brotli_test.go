@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/http/httptest"
+	"ngstaticserver/serve/headers"
 	"ngstaticserver/test"
 	"path/filepath"
 	"strings"
@@ -69,5 +70,5 @@ func TestFileRequestGzip_brotli(t *testing.T) {
 func createTestContext_brotli(t *testing.T) (test.TestDir, Endpoint) {
 	context := test.NewTestDir(t)
 	context.WriteFile(File, strings.Repeat("example", 10))
-	return context, BrotliFileEndpoint{filepath.Join(context.Path, File), time.Now(), "no-store"}
+	return context, CompressedFileEndpoint{filepath.Join(context.Path, File), time.Now(), "no-store", nil, nil, headers.BROTLI, nil}
 }
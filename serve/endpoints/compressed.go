@@ -0,0 +1,38 @@
+package endpoints
+
+import (
+	"net/http"
+	"ngstaticserver/serve/cache"
+	"ngstaticserver/serve/headers"
+	"time"
+)
+
+// CompressedFileEndpoint serves a file with pre-compressed variants
+// (.br, .gz and/or .zst), picking the variant according to the
+// Accept-Encoding header of the request and the server preference order.
+type CompressedFileEndpoint struct {
+	Path         string
+	ModTime      time.Time
+	CacheControl string
+	Cache        *cache.AssetCache
+	ETags        ETags
+	Encodings    headers.Encoding
+	Preference   []headers.Encoding
+}
+
+func (endpoint CompressedFileEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	encoding, ok := headers.ResolveAcceptEncoding(r).Negotiate(endpoint.Encodings, endpoint.Preference)
+	if !ok {
+		notAcceptable(w)
+		return
+	}
+	f, err := endpoint.Cache.Open(endpoint.Path + encoding.Extension())
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	setVariantHeaders(w, encoding.Name(), endpoint.ETags[encoding.Name()])
+	w.Header().Set("Cache-Control", endpoint.CacheControl)
+	http.ServeContent(w, r, endpoint.Path, endpoint.ModTime, f)
+}
@@ -0,0 +1,92 @@
+package endpoints
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"ngstaticserver/serve/headers"
+	"os"
+	"sync"
+	"time"
+)
+
+// ETags maps a Content-Encoding (empty for the uncompressed file) to the
+// strong ETag of the corresponding variant.
+type ETags map[string]string
+
+// ResolveETags calculates the ETag of the file and of its pre-compressed
+// variants for the available encodings. As every variant is hashed separately,
+// the ETags of the variants differ and conditional requests are validated
+// against the variant which would actually be served.
+func ResolveETags(filePath string, available headers.Encoding) ETags {
+	etags := make(ETags)
+	for _, encoding := range []headers.Encoding{headers.NO_COMPRESSION, headers.BROTLI, headers.GZIP, headers.ZSTD} {
+		if encoding != headers.NO_COMPRESSION && available&encoding == 0 {
+			continue
+		}
+		etag, err := computeFileETag(filePath + encoding.Extension())
+		if err == nil {
+			etags[encoding.Name()] = etag
+		}
+	}
+
+	return etags
+}
+
+// fileETag is the ETag of a file, which is valid as long as the size and the
+// modification time of the file are unchanged.
+type fileETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// fileETags caches the ETags by file path, as the routes (and with them the
+// ETags) are resolved again whenever a file of the app changes.
+var fileETags = struct {
+	sync.Mutex
+	entries map[string]fileETag
+}{entries: make(map[string]fileETag)}
+
+func computeFileETag(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	fileETags.Lock()
+	cached, ok := fileETags.entries[filePath]
+	fileETags.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag, nil
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	etag := fmt.Sprintf(`"%x"`, hash.Sum(nil)[:16])
+	fileETags.Lock()
+	fileETags.entries[filePath] = fileETag{info.Size(), info.ModTime(), etag}
+	fileETags.Unlock()
+	return etag, nil
+}
+
+// computeContentETag calculates the ETag of rendered content, which is
+// compressed on the fly with the given encoding. The compression is
+// deterministic, so the encoding suffix suffices to distinguish the variants.
+func computeContentETag(content []byte, encoding string) string {
+	hash := sha256.Sum256(content)
+	if encoding == "" {
+		return fmt.Sprintf(`"%x"`, hash[:16])
+	}
+
+	return fmt.Sprintf(`"%x-%v"`, hash[:16], encoding)
+}
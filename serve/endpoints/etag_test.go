@@ -0,0 +1,147 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"ngstaticserver/constants"
+	"ngstaticserver/serve/config"
+	"ngstaticserver/serve/headers"
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVariantETags(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(File, strings.Repeat("example", 10))
+	context.CompressFile(File)
+	filePath := filepath.Join(context.Path, File)
+	encodings := headers.Encoding(headers.BROTLI | headers.GZIP | headers.ZSTD)
+	handler := CompressedFileEndpoint{filePath, time.Now(), "no-store", nil, ResolveETags(filePath, encodings), encodings, nil}
+
+	etags := make(map[string]bool)
+	for _, encoding := range []string{"", "br", "gzip", "zstd"} {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+		req.Header.Add("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		handler.Handle(w, req, make(map[string]string))
+
+		resp := w.Result()
+		test.AssertEqual(t, resp.StatusCode, 200)
+		test.AssertEqual(t, resp.Header.Get("Vary"), "Accept-Encoding")
+		test.AssertEqual(t, resp.Header.Get("Content-Encoding"), encoding)
+		etag := resp.Header.Get("ETag")
+		test.AssertTrue(t, strings.HasPrefix(etag, `"`))
+		etags[etag] = true
+
+		req = httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+		req.Header.Add("Accept-Encoding", encoding)
+		req.Header.Add("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		handler.Handle(w, req, make(map[string]string))
+		test.AssertEqual(t, w.Result().StatusCode, 304)
+		test.AssertEqual(t, w.Result().Header.Get("ETag"), etag)
+	}
+	test.AssertEqual(t, len(etags), 4)
+}
+
+func TestVariantETagMismatch(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(File, strings.Repeat("example", 10))
+	context.CompressFile(File)
+	filePath := filepath.Join(context.Path, File)
+	encodings := headers.Encoding(headers.BROTLI | headers.GZIP)
+	etags := ResolveETags(filePath, encodings)
+	handler := CompressedFileEndpoint{filePath, time.Now(), "no-store", nil, etags, encodings, nil}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	req.Header.Add("Accept-Encoding", "gzip")
+	req.Header.Add("If-None-Match", etags["br"])
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("ETag"), etags["gzip"])
+}
+
+func TestUncompressedETag(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(File, strings.Repeat("example", 10))
+	filePath := filepath.Join(context.Path, File)
+	handler := UncompressedFileEndpoint{filePath, time.Now(), "no-store", nil, ResolveETags(filePath, headers.NO_COMPRESSION)}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	req.Header.Add("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("Vary"), "")
+	test.AssertTrue(t, len(resp.Header.Get("ETag")) > 0)
+}
+
+func TestRenderedIndexETag(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	handler := IndexEndpoint{
+		filepath.Join(context.Path, "de-CH/index.html"),
+		headers.NO_COMPRESSION,
+		int(constants.DefaultCompressionThreshold),
+		time.Now(),
+		config.DefaultAppVariables(),
+		nil,
+		nil,
+		nil,
+	}
+	insertVariables(handler.AppVariables)
+
+	request := func(encoding, ifNoneMatch string) (int, string) {
+		req := httptest.NewRequest("GET", "/de-CH", nil)
+		req.Header.Add("Accept-Encoding", encoding)
+		req.Header.Add("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		handler.Handle(w, req, make(map[string]string))
+		resp := w.Result()
+		test.AssertEqual(t, resp.Header.Get("Vary"), "Accept-Encoding")
+		return resp.StatusCode, resp.Header.Get("ETag")
+	}
+
+	status, brotliETag := request("br", "")
+	test.AssertEqual(t, status, 200)
+	status, gzipETag := request("gzip", "")
+	test.AssertEqual(t, status, 200)
+	test.AssertTrue(t, brotliETag != gzipETag)
+
+	status, _ = request("br", brotliETag)
+	test.AssertEqual(t, status, 304)
+	status, _ = request("gzip", brotliETag)
+	test.AssertEqual(t, status, 200)
+
+	value := "changed"
+	handler.AppVariables.MergeVariables(map[string]*string{"TEST": &value})
+	status, changedETag := request("br", brotliETag)
+	test.AssertEqual(t, status, 200)
+	test.AssertTrue(t, changedETag != brotliETag)
+}
+
+func TestFileETagCache(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(File, strings.Repeat("example", 10))
+	filePath := filepath.Join(context.Path, File)
+	etag := ResolveETags(filePath, headers.NO_COMPRESSION)[""]
+	info, err := os.Stat(filePath)
+	test.AssertNoError(t, err)
+
+	// The file is not hashed again, while its size and modification time are unchanged
+	context.WriteFile(File, strings.Repeat("EXAMPLE", 10))
+	test.AssertNoError(t, os.Chtimes(filePath, info.ModTime(), info.ModTime()))
+	test.AssertEqual(t, ResolveETags(filePath, headers.NO_COMPRESSION)[""], etag)
+
+	context.WriteFile(File, strings.Repeat("example", 11))
+	test.AssertTrue(t, ResolveETags(filePath, headers.NO_COMPRESSION)[""] != etag)
+}
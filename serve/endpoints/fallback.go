@@ -0,0 +1,103 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FallbackAuto falls back to the index for navigation requests only.
+	FallbackAuto = "auto"
+	// FallbackAlways falls back to the index for every unknown path.
+	FallbackAlways = "always"
+	// FallbackStrict never falls back to the index.
+	FallbackStrict = "strict"
+)
+
+// FallbackPolicy decides whether a request for a path without a matching
+// file is answered by the index (i.e. handled by the Angular router) or
+// with a 404, so that missing scripts or assets are not served as HTML.
+type FallbackPolicy struct {
+	Mode    string
+	Exclude []*regexp.Regexp
+}
+
+func ParseFallbackPolicy(mode string, exclude []string) (FallbackPolicy, error) {
+	if mode != FallbackAuto && mode != FallbackAlways && mode != FallbackStrict {
+		return FallbackPolicy{}, fmt.Errorf("invalid fallback mode %v (must either be auto, always or strict)", mode)
+	}
+
+	policy := FallbackPolicy{Mode: mode, Exclude: make([]*regexp.Regexp, 0, len(exclude))}
+	for _, glob := range exclude {
+		glob = strings.TrimSpace(glob)
+		if len(glob) > 0 {
+			policy.Exclude = append(policy.Exclude, GlobToRegexp(glob))
+		}
+	}
+
+	return policy, nil
+}
+
+func (policy FallbackPolicy) Allows(r *http.Request) bool {
+	if policy.Mode == FallbackStrict {
+		return false
+	} else if policy.Mode == FallbackAlways {
+		return true
+	}
+
+	for _, exclude := range policy.Exclude {
+		if exclude.MatchString(r.URL.Path) {
+			return false
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return true
+	}
+
+	return path.Ext(r.URL.Path) == ""
+}
+
+// GlobToRegexp converts a glob, in which * matches within a path segment and
+// ** matches across path segments, to an anchored regular expression. A **/
+// also matches no directory (e.g. **/index.html matches index.html).
+func GlobToRegexp(glob string) *regexp.Regexp {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		if strings.HasPrefix(glob[i:], "**/") {
+			builder.WriteString("(?:.*/)?")
+			i += 2
+		} else if strings.HasPrefix(glob[i:], "**") {
+			builder.WriteString(".*")
+			i++
+		} else if glob[i] == '*' {
+			builder.WriteString("[^/]*")
+		} else if glob[i] == '?' {
+			builder.WriteString("[^/]")
+		} else {
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	builder.WriteString("$")
+	return regexp.MustCompile(builder.String())
+}
+
+// FallbackEndpoint guards an index (or root) endpoint registered for a
+// catch-all route with a FallbackPolicy.
+type FallbackEndpoint struct {
+	Endpoint Endpoint
+	Policy   FallbackPolicy
+}
+
+func (endpoint FallbackEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	if !endpoint.Policy.Allows(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	endpoint.Endpoint.Handle(w, r, p)
+}
@@ -0,0 +1,54 @@
+package endpoints
+
+import (
+	"net/http/httptest"
+	"ngstaticserver/test"
+	"testing"
+)
+
+func TestFallbackPolicy_auto(t *testing.T) {
+	policy, err := ParseFallbackPolicy(FallbackAuto, []string{"/api/**"})
+	test.AssertNoError(t, err)
+
+	test.AssertTrue(t, policy.Allows(httptest.NewRequest("GET", "/", nil)))
+	test.AssertTrue(t, policy.Allows(httptest.NewRequest("GET", "/products/42", nil)))
+	test.AssertTrue(t, !policy.Allows(httptest.NewRequest("GET", "/chunk-ABC123.js", nil)))
+	test.AssertTrue(t, !policy.Allows(httptest.NewRequest("GET", "/assets/logo.png", nil)))
+	test.AssertTrue(t, !policy.Allows(httptest.NewRequest("GET", "/api/users/1", nil)))
+
+	req := httptest.NewRequest("GET", "/users/john.doe", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	test.AssertTrue(t, policy.Allows(req))
+}
+
+func TestFallbackPolicy_always(t *testing.T) {
+	policy, err := ParseFallbackPolicy(FallbackAlways, []string{})
+	test.AssertNoError(t, err)
+
+	test.AssertTrue(t, policy.Allows(httptest.NewRequest("GET", "/chunk-ABC123.js", nil)))
+}
+
+func TestFallbackPolicy_strict(t *testing.T) {
+	policy, err := ParseFallbackPolicy(FallbackStrict, []string{})
+	test.AssertNoError(t, err)
+
+	req := httptest.NewRequest("GET", "/products/42", nil)
+	req.Header.Set("Accept", "text/html")
+	test.AssertTrue(t, !policy.Allows(req))
+}
+
+func TestFallbackPolicy_invalid(t *testing.T) {
+	_, err := ParseFallbackPolicy("sometimes", []string{})
+	test.AssertTrue(t, err != nil)
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	test.AssertTrue(t, GlobToRegexp("/assets/*").MatchString("/assets/logo.png"))
+	test.AssertTrue(t, !GlobToRegexp("/assets/*").MatchString("/assets/i18n/de.json"))
+	test.AssertTrue(t, GlobToRegexp("/assets/**").MatchString("/assets/i18n/de.json"))
+	test.AssertTrue(t, GlobToRegexp("/*.map").MatchString("/main.js.map"))
+	test.AssertTrue(t, !GlobToRegexp("/main.?s").MatchString("/main.css"))
+	test.AssertTrue(t, GlobToRegexp("**/index.html").MatchString("index.html"))
+	test.AssertTrue(t, GlobToRegexp("**/index.html").MatchString("de-CH/index.html"))
+	test.AssertTrue(t, !GlobToRegexp("**/index.html").MatchString("de-CH/not-index.html"))
+}
@@ -0,0 +1,109 @@
+package endpoints
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"ngstaticserver/serve/headers"
+	"strings"
+)
+
+// HostLocale maps a host (e.g. example.de) to a locale.
+type HostLocale struct {
+	Host   string
+	Locale string
+}
+
+// HostLocales selects the locale by the requested host, e.g. for country
+// domains served by the same app.
+type HostLocales struct {
+	// Hosts in configuration order. The first host of a locale is its
+	// canonical host.
+	Hosts  []HostLocale
+	Origin headers.Origin
+	// Redirect permanently redirects requests for a locale to its canonical
+	// host, if the requested host is mapped to another locale.
+	Redirect bool
+}
+
+// ParseHostLocales parses host=locale entries (e.g. example.de=de).
+func ParseHostLocales(values []string) ([]HostLocale, error) {
+	result := make([]HostLocale, 0, len(values))
+	for _, value := range values {
+		host, locale, ok := strings.Cut(value, "=")
+		host = strings.TrimSpace(host)
+		locale = strings.TrimSpace(locale)
+		if !ok || len(host) == 0 || len(locale) == 0 || strings.ContainsAny(host, "/:") {
+			return nil, fmt.Errorf("invalid i18n host mapping %v (expected e.g. example.de=de)", value)
+		}
+		result = append(result, HostLocale{strings.ToLower(host), locale})
+	}
+
+	return result, nil
+}
+
+// Lookup returns the locale mapped to the requested host.
+func (hosts *HostLocales) Lookup(r *http.Request) (string, bool) {
+	if hosts == nil {
+		return "", false
+	}
+	_, host := hosts.Origin.ResolveHost(r)
+	host = hostname(host)
+	for _, entry := range hosts.Hosts {
+		if entry.Host == host {
+			return entry.Locale, true
+		}
+	}
+
+	return "", false
+}
+
+// CanonicalHost returns the first host mapped to the locale.
+func (hosts *HostLocales) CanonicalHost(locale string) (string, bool) {
+	if hosts == nil {
+		return "", false
+	}
+	for _, entry := range hosts.Hosts {
+		if entry.Locale == locale {
+			return entry.Host, true
+		}
+	}
+
+	return "", false
+}
+
+// RedirectLocation returns the URL on the canonical host, if the requested
+// path belongs to a locale (e.g. /fr/products) and the requested host is
+// mapped to another locale. Unmapped hosts (e.g. internal health checks)
+// are never redirected.
+func (hosts *HostLocales) RedirectLocation(r *http.Request) (string, bool) {
+	if hosts == nil || !hosts.Redirect {
+		return "", false
+	}
+	hostLocale, ok := hosts.Lookup(r)
+	if !ok {
+		return "", false
+	}
+	locale, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if locale == hostLocale {
+		return "", false
+	}
+	canonicalHost, ok := hosts.CanonicalHost(locale)
+	if !ok {
+		return "", false
+	}
+
+	scheme, _ := hosts.Origin.ResolveHost(r)
+	location := scheme + "://" + canonicalHost + r.URL.EscapedPath()
+	if len(r.URL.RawQuery) > 0 {
+		location += "?" + r.URL.RawQuery
+	}
+	return location, true
+}
+
+func hostname(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,57 @@
+package endpoints
+
+import (
+	"net/http/httptest"
+	"ngstaticserver/test"
+	"testing"
+)
+
+func TestParseHostLocales(t *testing.T) {
+	hosts, err := ParseHostLocales([]string{"Example.de=de", " example.fr = fr "})
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, len(hosts), 2)
+	test.AssertEqual(t, hosts[0], HostLocale{"example.de", "de"})
+	test.AssertEqual(t, hosts[1], HostLocale{"example.fr", "fr"})
+
+	for _, value := range []string{"example.de", "=de", "example.de=", "https://example.de=de"} {
+		_, err = ParseHostLocales([]string{value})
+		test.AssertTrue(t, err != nil)
+	}
+}
+
+func TestHostLocalesLookup(t *testing.T) {
+	hosts := &HostLocales{Hosts: []HostLocale{{"example.de", "de"}, {"example.fr", "fr"}}}
+
+	locale, ok := hosts.Lookup(httptest.NewRequest("GET", "http://EXAMPLE.fr:8080/", nil))
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, locale, "fr")
+
+	_, ok = hosts.Lookup(httptest.NewRequest("GET", "http://localhost/", nil))
+	test.AssertTrue(t, !ok)
+
+	var none *HostLocales
+	_, ok = none.Lookup(httptest.NewRequest("GET", "http://example.fr/", nil))
+	test.AssertTrue(t, !ok)
+}
+
+func TestHostLocalesRedirectLocation(t *testing.T) {
+	hosts := &HostLocales{
+		Hosts:    []HostLocale{{"example.de", "de"}, {"example.ch", "de"}, {"example.fr", "fr"}},
+		Redirect: true,
+	}
+
+	location, ok := hosts.RedirectLocation(httptest.NewRequest("GET", "https://example.de/fr/products?id=1", nil))
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, location, "https://example.fr/fr/products?id=1")
+
+	_, ok = hosts.RedirectLocation(httptest.NewRequest("GET", "https://example.ch/de/products", nil))
+	test.AssertTrue(t, !ok)
+	_, ok = hosts.RedirectLocation(httptest.NewRequest("GET", "http://localhost/fr/products", nil))
+	test.AssertTrue(t, !ok)
+	_, ok = hosts.RedirectLocation(httptest.NewRequest("GET", "https://example.de/assets/logo.svg", nil))
+	test.AssertTrue(t, !ok)
+
+	hosts.Redirect = false
+	_, ok = hosts.RedirectLocation(httptest.NewRequest("GET", "https://example.de/fr/products", nil))
+	test.AssertTrue(t, !ok)
+}
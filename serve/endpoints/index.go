@@ -22,51 +22,74 @@ type IndexEndpoint struct {
 	CompressionThreshold int
 	ModTime              time.Time
 	AppVariables         *config.AppVariables
+	ETags                ETags
+	Preference           []headers.Encoding
+	Alternates           *LocaleAlternates
 }
 
 func (endpoint IndexEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
-	if endpoint.AppVariables.IsEmpty() {
+	endpoint.Alternates.Apply(w, r)
+	snapshot := endpoint.AppVariables.Snapshot()
+	if snapshot.IsEmpty() {
 		endpoint.handleEmptyAppConfig(w, r, p)
 	} else {
-		endpoint.handleAppConfig(w, r, p)
+		endpoint.handleAppConfig(w, r, snapshot)
 	}
 }
 
 func (endpoint IndexEndpoint) handleEmptyAppConfig(w http.ResponseWriter, r *http.Request, p map[string]string) {
-	acceptedEncoding := headers.ResolveAcceptEncoding(r)
-	path := endpoint.Path
-	if acceptedEncoding.AllowsBrotli() && endpoint.PreCompression.ContainsBrotli() {
-		path += ".br"
-		w.Header().Set("Content-Encoding", "br")
-	} else if acceptedEncoding.AllowsGzip() && endpoint.PreCompression.ContainsGzip() {
-		path += ".gz"
-		w.Header().Set("Content-Encoding", "gzip")
+	encoding, ok := headers.ResolveAcceptEncoding(r).Negotiate(endpoint.PreCompression, endpoint.Preference)
+	if !ok {
+		notAcceptable(w)
+		return
+	}
+	f, err := os.Open(endpoint.Path + encoding.Extension())
+	if err != nil {
+		http.NotFound(w, r)
+		return
 	}
-	f, _ := os.Open(path)
 	defer f.Close()
+	if endpoint.PreCompression.NoCompression() {
+		if etag, ok := endpoint.ETags[""]; ok {
+			w.Header().Set("ETag", etag)
+		}
+	} else {
+		setVariantHeaders(w, encoding.Name(), endpoint.ETags[encoding.Name()])
+	}
 
 	// https://web.dev/http-cache/?hl=en#flowchart
 	w.Header().Set("Cache-Control", "no-cache")
 	http.ServeContent(w, r, endpoint.Path, endpoint.ModTime, f)
 }
 
-func (endpoint IndexEndpoint) handleAppConfig(w http.ResponseWriter, r *http.Request, p map[string]string) {
+func (endpoint IndexEndpoint) handleAppConfig(w http.ResponseWriter, r *http.Request, snapshot config.Snapshot) {
 	acceptedEncoding := headers.ResolveAcceptEncoding(r)
-	content, _ := os.ReadFile(endpoint.Path)
-	content, _ = endpoint.AppVariables.Insert(content, false)
-
-	isAboveThreshold := len(content) >= endpoint.CompressionThreshold
-	if isAboveThreshold && acceptedEncoding.AllowsBrotli() {
-		content = compress.CompressWithBrotliFast(content)
-		w.Header().Set("Content-Encoding", "br")
-	} else if isAboveThreshold && acceptedEncoding.AllowsGzip() {
-		content = compress.CompressWithGzipFast(content)
-		w.Header().Set("Content-Encoding", "gzip")
+	content, err := os.ReadFile(endpoint.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	content, _ = snapshot.Insert(content, "", false)
+
+	// The rendered content changes with the app variables, so its ETag
+	// cannot be calculated in advance. Content below the compression
+	// threshold is still compressed, if identity is not acceptable, so every
+	// response varies by Accept-Encoding.
+	if len(content) >= endpoint.CompressionThreshold || !acceptedEncoding.AllowsIdentity() {
+		encoding, ok := acceptedEncoding.Negotiate(dynamicCompression, endpoint.Preference)
+		if !ok {
+			notAcceptable(w)
+			return
+		}
+		setVariantHeaders(w, encoding.Name(), computeContentETag(content, encoding.Name()))
+		content = compressFast(content, encoding)
+	} else {
+		setVariantHeaders(w, "", computeContentETag(content, ""))
 	}
 
 	// https://web.dev/http-cache/?hl=en#flowchart
 	w.Header().Set("Cache-Control", "no-cache")
-	http.ServeContent(w, r, endpoint.Path, endpoint.AppVariables.LastChangedAt, bytes.NewReader(content))
+	http.ServeContent(w, r, endpoint.Path, snapshot.LastChangedAt, bytes.NewReader(content))
 }
 
 type CspIndexEndpoint struct {
@@ -74,17 +97,25 @@ type CspIndexEndpoint struct {
 	CompressionThreshold int
 	AppVariables         *config.AppVariables
 	Csp                  string
+	Preference           []headers.Encoding
+	Alternates           *LocaleAlternates
 }
 
 func (endpoint CspIndexEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	endpoint.Alternates.Apply(w, r)
 	acceptedEncoding := headers.ResolveAcceptEncoding(r)
-	content, _ := os.ReadFile(endpoint.Path)
+	content, err := os.ReadFile(endpoint.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
 	cspNonce := generateNonce()
 	csp := strings.ReplaceAll(endpoint.Csp, "${NGSS_CSP_NONCE}", fmt.Sprintf("'nonce-%v'", cspNonce))
-	if !endpoint.AppVariables.IsEmpty() {
-		endpoint.AppVariables.Update("NGSS_CSP_NONCE", cspNonce)
+	// The nonce is only inserted into the content of this request, as the
+	// app variables are shared between concurrent requests.
+	if snapshot := endpoint.AppVariables.Snapshot(); !snapshot.IsEmpty() {
 		var cspHash string
-		content, cspHash = endpoint.AppVariables.Insert(content, true)
+		content, cspHash = snapshot.Insert(content, cspNonce, true)
 		csp = strings.Replace(csp, "${NGSS_CSP_SCRIPT_HASH}", cspHash, -1)
 	} else {
 		csp = strings.Replace(csp, "${NGSS_CSP_SCRIPT_HASH}", "", -1)
@@ -95,13 +126,17 @@ func (endpoint CspIndexEndpoint) Handle(w http.ResponseWriter, r *http.Request,
 	w.Header().Set("Content-Security-Policy", csp)
 
 	content = []byte(contentAsString)
-	isAboveThreshold := len(content) >= endpoint.CompressionThreshold
-	if isAboveThreshold && acceptedEncoding.AllowsBrotli() {
-		content = compress.CompressWithBrotliFast(content)
-		w.Header().Set("Content-Encoding", "br")
-	} else if isAboveThreshold && acceptedEncoding.AllowsGzip() {
-		content = compress.CompressWithGzipFast(content)
-		w.Header().Set("Content-Encoding", "gzip")
+	// The content contains a new nonce for every request, so no ETag is used.
+	if len(content) >= endpoint.CompressionThreshold || !acceptedEncoding.AllowsIdentity() {
+		encoding, ok := acceptedEncoding.Negotiate(dynamicCompression, endpoint.Preference)
+		if !ok {
+			notAcceptable(w)
+			return
+		}
+		setVariantHeaders(w, encoding.Name(), "")
+		content = compressFast(content, encoding)
+	} else {
+		setVariantHeaders(w, "", "")
 	}
 
 	// https://web.dev/http-cache/?hl=en#flowchart
@@ -109,6 +144,23 @@ func (endpoint CspIndexEndpoint) Handle(w http.ResponseWriter, r *http.Request,
 	http.ServeContent(w, r, endpoint.Path, time.Now(), bytes.NewReader(content))
 }
 
+// dynamicCompression contains the encodings available for content, which is
+// rendered per request.
+const dynamicCompression headers.Encoding = headers.BROTLI | headers.GZIP | headers.ZSTD
+
+func compressFast(content []byte, encoding headers.Encoding) []byte {
+	switch encoding {
+	case headers.BROTLI:
+		return compress.CompressWithBrotliFast(content)
+	case headers.GZIP:
+		return compress.CompressWithGzipFast(content)
+	case headers.ZSTD:
+		return compress.CompressWithZstdFast(content)
+	default:
+		return content
+	}
+}
+
 const chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 var runeCharts = []rune(chars)
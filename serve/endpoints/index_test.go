@@ -1,6 +1,7 @@
 package endpoints
 
 import (
+	"fmt"
 	"io"
 	"net/http/httptest"
 	"ngstaticserver/constants"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -246,6 +248,76 @@ func TestCspIndexRequest_brotli_withVariables(t *testing.T) {
 	}
 }
 
+func TestCspIndexRequest_concurrentNonces(t *testing.T) {
+	_, handler := createTestContext_cspIndex(t, headers.NO_COMPRESSION)
+	handler.CompressionThreshold = 1024 * 1024
+	placeholder := "placeholder"
+	handler.AppVariables.MergeVariables(map[string]*string{"NGSS_CSP_NONCE": &placeholder})
+	nonceRegex := regexp.MustCompile(`'nonce-([A-Za-z0-9]+)'`)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			value := fmt.Sprintf("value-%v", i)
+			handler.AppVariables.MergeVariables(map[string]*string{"NGSS_CSP_NONCE": &placeholder, "TEST": &value})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				req := httptest.NewRequest("GET", "/de-CH", nil)
+				w := httptest.NewRecorder()
+				handler.Handle(w, req, make(map[string]string))
+
+				match := nonceRegex.FindStringSubmatch(w.Result().Header.Get("Content-Security-Policy"))
+				test.AssertEqual(t, len(match), 2)
+				if len(match) == 2 {
+					test.AssertTrue(t, strings.Contains(w.Body.String(), fmt.Sprintf(`"NGSS_CSP_NONCE":"%v"`, match[1])))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	<-done
+	test.AssertEqual(t, *handler.AppVariables.Snapshot().Variables["NGSS_CSP_NONCE"], placeholder)
+}
+
+func TestIndexRequest_concurrentMerges(t *testing.T) {
+	_, handler := createTestContext_index(t, headers.NO_COMPRESSION)
+	insertVariables(handler.AppVariables)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			value := fmt.Sprintf("value-%v", i)
+			handler.AppVariables.MergeVariables(map[string]*string{"TEST": &value})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				req := httptest.NewRequest("GET", "/de-CH", nil)
+				req.Header.Add("Accept-Encoding", "br")
+				w := httptest.NewRecorder()
+				handler.Handle(w, req, make(map[string]string))
+				test.AssertEqual(t, w.Result().StatusCode, 200)
+			}
+		}()
+	}
+	wg.Wait()
+	<-done
+}
+
 func createTestContext_index(t *testing.T, encoding headers.Encoding) (test.TestDir, IndexEndpoint) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("i18n")
@@ -256,6 +328,9 @@ func createTestContext_index(t *testing.T, encoding headers.Encoding) (test.Test
 		int(constants.DefaultCompressionThreshold),
 		time.Now(),
 		config.DefaultAppVariables(),
+		nil,
+		nil,
+		nil,
 	}
 }
 
@@ -268,6 +343,8 @@ func createTestContext_cspIndex(t *testing.T, encoding headers.Encoding) (test.T
 		int(constants.DefaultCompressionThreshold),
 		config.DefaultAppVariables(),
 		constants.CspTemplate,
+		nil,
+		nil,
 	}
 }
 
@@ -277,3 +354,58 @@ func insertVariables(appVariables *config.AppVariables) {
 		"TEST": &value,
 	})
 }
+
+func TestIndexRequestIdentityRejected_withVariables(t *testing.T) {
+	context, handler := createTestContext_index(t, headers.NO_COMPRESSION)
+	handler.CompressionThreshold = 1024 * 1024
+	insertVariables(handler.AppVariables)
+	content := context.ReadFile("de-CH/index.html")
+
+	req := httptest.NewRequest("GET", "/de-CH", nil)
+	req.Header.Add("Accept-Encoding", "gzip, identity;q=0")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "gzip")
+	test.AssertTrue(t, strings.HasPrefix(string(test.DecompressGzip(body)), content[:strings.Index(content, "</title>")]))
+}
+
+func TestIndexRequestNotAcceptable(t *testing.T) {
+	_, handler := createTestContext_index(t, headers.BROTLI)
+
+	req := httptest.NewRequest("GET", "/de-CH", nil)
+	req.Header.Add("Accept-Encoding", "gzip, identity;q=0")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	test.AssertEqual(t, w.Result().StatusCode, 406)
+}
+
+func TestIndexRequestBelowThreshold_vary(t *testing.T) {
+	_, handler := createTestContext_index(t, headers.NO_COMPRESSION)
+	handler.CompressionThreshold = 1024 * 1024
+	insertVariables(handler.AppVariables)
+	_, cspHandler := createTestContext_cspIndex(t, headers.NO_COMPRESSION)
+	cspHandler.CompressionThreshold = 1024 * 1024
+
+	for _, endpoint := range []Endpoint{handler, cspHandler} {
+		for acceptEncoding, contentEncoding := range map[string]string{
+			"gzip":               "",
+			"gzip, identity;q=0": "gzip",
+		} {
+			req := httptest.NewRequest("GET", "/de-CH", nil)
+			req.Header.Add("Accept-Encoding", acceptEncoding)
+			w := httptest.NewRecorder()
+			endpoint.Handle(w, req, make(map[string]string))
+
+			resp := w.Result()
+			test.AssertEqual(t, resp.StatusCode, 200)
+			test.AssertEqual(t, resp.Header.Get("Content-Encoding"), contentEncoding)
+			test.AssertEqual(t, resp.Header.Get("Vary"), "Accept-Encoding")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package endpoints
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"golang.org/x/net/html"
+)
+
+// languageTagRegex checks whether a value is a well-formed BCP 47 language tag
+// (https://www.rfc-editor.org/rfc/rfc5646#section-2.1). The subtags are not
+// validated against the IANA registry, but as no primary language subtags
+// with more than three letters are registered, those are rejected.
+var languageTagRegex = regexp.MustCompile(`(?i)^[a-z]{2,3}(?:-[a-z]{3}){0,3}` +
+	`(?:-[a-z]{4})?(?:-(?:[a-z]{2}|[0-9]{3}))?(?:-(?:[a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*` +
+	`(?:-[0-9a-wyz](?:-[a-z0-9]{2,8})+)*(?:-x(?:-[a-z0-9]{1,8})+)?$`)
+
+func IsLanguageTag(value string) bool {
+	return languageTagRegex.MatchString(value)
+}
+
+// ResolveLocales returns the locale directories of an i18n build. If locales
+// are given explicitly, each of them must contain an index.html. Otherwise
+// every directory with an index.html, whose <html lang> attribute is a valid
+// language tag, is a locale (so that e.g. assets directories are ignored).
+// An error is returned, if no directory with an index.html exists or none
+// of them is a locale.
+func ResolveLocales(workingDirectory string, locales []string) ([]string, error) {
+	if len(locales) > 0 {
+		for _, locale := range locales {
+			if !fileExists(filepath.Join(workingDirectory, locale, "index.html")) {
+				return nil, fmt.Errorf("i18n locale %v has no index.html in %v", locale, workingDirectory)
+			}
+		}
+		return locales, nil
+	}
+
+	entries, err := os.ReadDir(workingDirectory)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	hasIndex := false
+	for _, entry := range entries {
+		indexPath := filepath.Join(workingDirectory, entry.Name(), "index.html")
+		if !entry.IsDir() || !fileExists(indexPath) {
+			continue
+		}
+		hasIndex = true
+		lang, err := readHtmlLang(indexPath)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Failed to read %v", indexPath), "error", err)
+		} else if !IsLanguageTag(lang) {
+			slog.Debug(fmt.Sprintf("Ignoring %v as i18n locale (lang attribute %q is not a valid language tag)", entry.Name(), lang))
+		} else {
+			result = append(result, entry.Name())
+		}
+	}
+
+	if !hasIndex {
+		return nil, fmt.Errorf(
+			"no index.html found in %v or any of its locale directories (expected e.g. en-US/index.html)",
+			workingDirectory)
+	} else if len(result) == 0 {
+		return nil, fmt.Errorf(
+			"no i18n locale found in %v (expected directories with an index.html containing e.g. <html lang=\"en-US\">, or configure --i18n-locales)",
+			workingDirectory)
+	}
+
+	return result, nil
+}
+
+func readHtmlLang(indexPath string) (string, error) {
+	f, err := os.Open(indexPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tokenizer := html.NewTokenizer(f)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return "", nil
+			}
+			return "", tokenizer.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "html" {
+				continue
+			}
+			for _, attribute := range token.Attr {
+				if attribute.Key == "lang" {
+					return attribute.Val, nil
+				}
+			}
+			return "", nil
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package endpoints
+
+import (
+	"ngstaticserver/test"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsLanguageTag(t *testing.T) {
+	for _, tag := range []string{"de", "de-CH", "en-US", "zh-Hant-TW", "sr-Latn", "es-419", "de-CH-1996", "en-x-private"} {
+		test.AssertTrue(t, IsLanguageTag(tag))
+	}
+	for _, tag := range []string{"", "assets", "e", "de_CH", "en-", "123", "media-files"} {
+		test.AssertTrue(t, !IsLanguageTag(tag))
+	}
+}
+
+func TestResolveLocales(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	test.AssertNoError(t, os.MkdirAll(filepath.Join(context.Path, "assets"), 0755))
+	context.WriteFile("assets/index.html", "<html><body>Not a locale</body></html>")
+	test.AssertNoError(t, os.MkdirAll(filepath.Join(context.Path, "media"), 0755))
+	context.WriteFile("media/logo.svg", "<svg></svg>")
+
+	locales, err := ResolveLocales(context.Path, nil)
+	test.AssertNoError(t, err)
+	test.AssertTrue(t, reflect.DeepEqual(locales, []string{"de-CH", "en-US", "fr"}))
+}
+
+func TestResolveLocales_explicit(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+
+	locales, err := ResolveLocales(context.Path, []string{"fr", "de-CH"})
+	test.AssertNoError(t, err)
+	test.AssertTrue(t, reflect.DeepEqual(locales, []string{"fr", "de-CH"}))
+
+	_, err = ResolveLocales(context.Path, []string{"fr", "it"})
+	test.AssertTrue(t, err != nil)
+}
+
+func TestResolveLocales_withoutLang(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	for _, locale := range []string{"de-CH", "en-US", "fr"} {
+		indexHtml := context.ReadFile(locale + "/index.html")
+		context.WriteFile(locale+"/index.html", strings.Replace(indexHtml, ` lang="`+locale+`"`, "", 1))
+	}
+
+	_, err := ResolveLocales(context.Path, nil)
+	test.AssertTrue(t, err != nil)
+}
+
+func TestResolveLocales_empty(t *testing.T) {
+	context := test.NewTestDir(t)
+	test.AssertNoError(t, os.MkdirAll(filepath.Join(context.Path, "assets"), 0755))
+	context.WriteFile("assets/logo.svg", "<svg></svg>")
+
+	_, err := ResolveLocales(context.Path, nil)
+	test.AssertTrue(t, err != nil)
+	test.AssertTrue(t, strings.Contains(err.Error(), "no index.html found"))
+}
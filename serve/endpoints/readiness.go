@@ -0,0 +1,25 @@
+package endpoints
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// ReadinessEndpoint reports UP while the server accepts traffic and answers
+// with 503 once shutdown started, so load balancers stop routing to it
+// before connections are drained.
+type ReadinessEndpoint struct {
+	Draining *atomic.Bool
+}
+
+func (endpoint ReadinessEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	if endpoint.Draining.Load() {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("DRAINING"))
+		return
+	}
+
+	HeartbeatEndpoint().Handle(w, r, p)
+}
@@ -0,0 +1,39 @@
+package endpoints
+
+import (
+	"io"
+	"net/http/httptest"
+	"ngstaticserver/test"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadiness_ready(t *testing.T) {
+	handler := ReadinessEndpoint{&atomic.Bool{}}
+
+	req := httptest.NewRequest("GET", "/__lbheartbeat__", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, string(body), "UP")
+}
+
+func TestReadiness_draining(t *testing.T) {
+	handler := ReadinessEndpoint{&atomic.Bool{}}
+	handler.Draining.Store(true)
+
+	req := httptest.NewRequest("GET", "/__lbheartbeat__", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	test.AssertEqual(t, resp.StatusCode, 503)
+	test.AssertEqual(t, resp.Header.Get("Cache-Control"), "no-cache")
+	test.AssertEqual(t, string(body), "DRAINING")
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"ngstaticserver/serve/cache"
 	"ngstaticserver/serve/config"
 	"ngstaticserver/serve/headers"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
@@ -31,7 +33,7 @@ type Endpoint interface {
 }
 
 func VersionEndpoint(filePath string) Endpoint {
-	handler, err := ResolveFileEndpoint(filePath, 0)
+	handler, err := ResolveFileEndpoint(filePath, 0, nil, nil)
 	if err != nil {
 		handler = InlineStringEndpoint{filePath, []byte("{\n  \"undefined\": \"app does not have a version.json file\"\n}")}
 	}
@@ -43,9 +45,8 @@ func HeartbeatEndpoint() Endpoint {
 	return InlineStringEndpoint{"heartbeat.txt", []byte("UP")}
 }
 
-func ResolveFileEndpoint(filePath string, cacheControlMaxAge int64) (Endpoint, error) {
-	hasBrotli := fileExists(filePath + ".br")
-	hasGzip := fileExists(filePath + ".gz")
+func ResolveFileEndpoint(filePath string, cacheControlMaxAge int64, assetCache *cache.AssetCache, preference []headers.Encoding) (Endpoint, error) {
+	encodings := resolvePreCompression(filePath)
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -59,60 +60,72 @@ func ResolveFileEndpoint(filePath string, cacheControlMaxAge int64) (Endpoint, e
 	if fingerprintRegex.MatchString(filePath) {
 		cacheControl = fmt.Sprintf("max-age=%d", cacheControlMaxAge)
 	}
-	if hasBrotli && hasGzip {
-		return BrotliGzipFileEndpoint{filePath, s.ModTime(), cacheControl}, nil
-	} else if hasBrotli {
-		return BrotliFileEndpoint{filePath, s.ModTime(), cacheControl}, nil
-	} else if hasGzip {
-		return GzipFileEndpoint{filePath, s.ModTime(), cacheControl}, nil
+	etags := ResolveETags(filePath, encodings)
+	if encodings.NoCompression() {
+		return UncompressedFileEndpoint{filePath, s.ModTime(), cacheControl, assetCache, etags}, nil
 	} else {
-		return UncompressedFileEndpoint{filePath, s.ModTime(), cacheControl}, nil
+		return CompressedFileEndpoint{filePath, s.ModTime(), cacheControl, assetCache, etags, encodings, preference}, nil
 	}
 }
 
-func ResolveIndexEndpoint(filePath string, compressionThreshold int, csp string, appVariables *config.AppVariables) Endpoint {
-	var encoding headers.Encoding = headers.NO_COMPRESSION
-	if fileExists(filePath + ".br") {
-		encoding ^= headers.BROTLI
-	}
-	if fileExists(filePath + ".gz") {
-		encoding ^= headers.GZIP
-	}
+func ResolveIndexEndpoint(filePath string, compressionThreshold int, csp string, appVariables *config.AppVariables, preference []headers.Encoding, alternates *LocaleAlternates) Endpoint {
+	encoding := resolvePreCompression(filePath)
 	content, _ := os.ReadFile(filePath)
 	contentAsString := string(content)
-	s, _ := os.Stat(filePath)
+	// The file might be removed between walking the tree and resolving the endpoint.
+	modTime := time.Now()
+	if s, err := os.Stat(filePath); err == nil {
+		modTime = s.ModTime()
+	}
 
 	if len(csp) > 0 && (strings.Contains(contentAsString, "${NGSS_CSP_NONCE}") || appVariables.Has("NGSS_CSP_NONCE")) {
 		csp, err := detectCspTokens(contentAsString, csp)
 		if err != nil {
 			slog.Warn(fmt.Sprintf("Failed to parse HTML in %v", filePath), "error", err)
 		}
-		return CspIndexEndpoint{filePath, compressionThreshold, appVariables, csp}
+		return CspIndexEndpoint{filePath, compressionThreshold, appVariables, csp, preference, alternates}
 	} else {
-		return IndexEndpoint{filePath, encoding, compressionThreshold, s.ModTime(), appVariables}
+		etags := ResolveETags(filePath, encoding)
+		return IndexEndpoint{filePath, encoding, compressionThreshold, modTime, appVariables, etags, preference, alternates}
 	}
 }
 
-func ResolveRootEndpoint(workingDirectory, i18nDefault string) Endpoint {
-	entries, _ := os.ReadDir(workingDirectory)
-	paths := make([]string, 0)
+// ResolveRootEndpoint creates the endpoint redirecting to the matching
+// locale. The locales (see ResolveLocales) must not be empty.
+func ResolveRootEndpoint(locales []string, i18nDefault string, hosts *HostLocales) Endpoint {
+	return RootEndpoint{ResolveDefaultLocale(locales, i18nDefault), locales, nil, hosts}
+}
+
+// ResolveDefaultLocale returns the configured default locale, if it exists,
+// or the first locale otherwise.
+func ResolveDefaultLocale(locales []string, i18nDefault string) string {
 	hasDefault := false
-	for _, e := range entries {
-		if e.IsDir() {
-			paths = append(paths, e.Name())
-			if !hasDefault && e.Name() == i18nDefault {
-				hasDefault = true
-			}
+	for _, locale := range locales {
+		if locale == i18nDefault {
+			hasDefault = true
+			break
 		}
 	}
 	if len(i18nDefault) == 0 {
-		i18nDefault = paths[0]
+		i18nDefault = locales[0]
 	} else if !hasDefault {
-		slog.Warn(fmt.Sprintf("i18n default %v does not exist (%v)", i18nDefault, strings.Join(paths, ", ")))
-		i18nDefault = paths[0]
+		slog.Warn(fmt.Sprintf("i18n default %v does not exist (%v)", i18nDefault, strings.Join(locales, ", ")))
+		i18nDefault = locales[0]
+	}
+
+	return i18nDefault
+}
+
+// resolvePreCompression detects the pre-compressed variants of a file.
+func resolvePreCompression(filePath string) headers.Encoding {
+	var encoding headers.Encoding = headers.NO_COMPRESSION
+	for _, candidate := range []headers.Encoding{headers.BROTLI, headers.GZIP, headers.ZSTD} {
+		if fileExists(filePath + candidate.Extension()) {
+			encoding |= candidate
+		}
 	}
 
-	return RootEndpoint{i18nDefault, paths}
+	return encoding
 }
 
 func fileExists(filePath string) bool {
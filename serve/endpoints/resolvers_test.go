@@ -39,7 +39,7 @@ func TestHeartbeatEndpoint(t *testing.T) {
 func TestFileEndpoint_uncompressed(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.WriteFile(File, strings.Repeat("example", 10))
-	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0)
+	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0, nil, nil)
 	test.AssertNoError(t, err)
 	_, isType := endpoint.(UncompressedFileEndpoint)
 	test.AssertTrue(t, isType)
@@ -48,7 +48,7 @@ func TestFileEndpoint_uncompressed(t *testing.T) {
 func TestFileEndpoint_uncompressed_fingerprinted(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.WriteFile("main.458f86595498b767.js", strings.Repeat("example", 10))
-	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, "main.458f86595498b767.js"), 0)
+	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, "main.458f86595498b767.js"), 0, nil, nil)
 	test.AssertNoError(t, err)
 	_, isType := endpoint.(UncompressedFileEndpoint)
 	test.AssertTrue(t, isType)
@@ -58,10 +58,11 @@ func TestFileEndpoint_brotli_gzip(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.WriteFile(File, strings.Repeat("example", 10))
 	context.CompressFile(File)
-	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0)
+	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0, nil, nil)
 	test.AssertNoError(t, err)
-	_, isType := endpoint.(BrotliGzipFileEndpoint)
+	compressedEndpoint, isType := endpoint.(CompressedFileEndpoint)
 	test.AssertTrue(t, isType)
+	test.AssertEqual(t, compressedEndpoint.Encodings, headers.Encoding(headers.BROTLI|headers.GZIP|headers.ZSTD))
 }
 
 func TestFileEndpoint_brotli(t *testing.T) {
@@ -69,10 +70,12 @@ func TestFileEndpoint_brotli(t *testing.T) {
 	context.WriteFile(File, strings.Repeat("example", 10))
 	context.CompressFile(File)
 	context.RemoveFile(File + ".gz")
-	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0)
+	context.RemoveFile(File + ".zst")
+	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0, nil, nil)
 	test.AssertNoError(t, err)
-	_, isType := endpoint.(BrotliFileEndpoint)
+	compressedEndpoint, isType := endpoint.(CompressedFileEndpoint)
 	test.AssertTrue(t, isType)
+	test.AssertEqual(t, compressedEndpoint.Encodings, headers.Encoding(headers.BROTLI))
 }
 
 func TestFileEndpoint_gzip(t *testing.T) {
@@ -80,10 +83,25 @@ func TestFileEndpoint_gzip(t *testing.T) {
 	context.WriteFile(File, strings.Repeat("example", 10))
 	context.CompressFile(File)
 	context.RemoveFile(File + ".br")
-	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0)
+	context.RemoveFile(File + ".zst")
+	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0, nil, nil)
 	test.AssertNoError(t, err)
-	_, isType := endpoint.(GzipFileEndpoint)
+	compressedEndpoint, isType := endpoint.(CompressedFileEndpoint)
 	test.AssertTrue(t, isType)
+	test.AssertEqual(t, compressedEndpoint.Encodings, headers.Encoding(headers.GZIP))
+}
+
+func TestFileEndpoint_zstd(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.WriteFile(File, strings.Repeat("example", 10))
+	context.CompressFile(File)
+	context.RemoveFile(File + ".br")
+	context.RemoveFile(File + ".gz")
+	endpoint, err := ResolveFileEndpoint(filepath.Join(context.Path, File), 0, nil, nil)
+	test.AssertNoError(t, err)
+	compressedEndpoint, isType := endpoint.(CompressedFileEndpoint)
+	test.AssertTrue(t, isType)
+	test.AssertEqual(t, compressedEndpoint.Encodings, headers.Encoding(headers.ZSTD))
 }
 
 func TestIndexEndpoint_noCsp(t *testing.T) {
@@ -93,7 +111,9 @@ func TestIndexEndpoint_noCsp(t *testing.T) {
 		filepath.Join(context.Path, "index.html"),
 		0,
 		"",
-		config.DefaultAppVariables())
+		config.DefaultAppVariables(),
+		nil,
+		nil)
 	indexEndpoint, isType := endpoint.(IndexEndpoint)
 	test.AssertTrue(t, isType)
 	test.AssertEqual(t, indexEndpoint.PreCompression, headers.Encoding(headers.NO_COMPRESSION))
@@ -107,10 +127,12 @@ func TestIndexEndpoint_emptyCsp(t *testing.T) {
 		filepath.Join(context.Path, "index.html"),
 		0,
 		"",
-		config.DefaultAppVariables())
+		config.DefaultAppVariables(),
+		nil,
+		nil)
 	indexEndpoint, isType := endpoint.(IndexEndpoint)
 	test.AssertTrue(t, isType)
-	test.AssertEqual(t, indexEndpoint.PreCompression, headers.Encoding(headers.BROTLI|headers.GZIP))
+	test.AssertEqual(t, indexEndpoint.PreCompression, headers.Encoding(headers.BROTLI|headers.GZIP|headers.ZSTD))
 }
 
 func TestIndexEndpoint_withCsp(t *testing.T) {
@@ -120,7 +142,9 @@ func TestIndexEndpoint_withCsp(t *testing.T) {
 		filepath.Join(context.Path, "index.html"),
 		0,
 		CspTemplate,
-		config.DefaultAppVariables())
+		config.DefaultAppVariables(),
+		nil,
+		nil)
 	indexEndpoint, isType := endpoint.(CspIndexEndpoint)
 	test.AssertTrue(t, isType)
 	test.AssertEqual(t, indexEndpoint.Csp, "default-src 'self' ; connect-src 'self' ; font-src 'self' ; img-src 'self' ; script-src 'self' ${NGSS_CSP_NONCE} ${NGSS_CSP_SCRIPT_HASH} ; style-src 'self' ${NGSS_CSP_NONCE}  ;")
@@ -136,7 +160,9 @@ func TestIndexEndpoint_withCsp_customHtml(t *testing.T) {
 		filepath.Join(context.Path, "index.html"),
 		0,
 		CspTemplate,
-		config.DefaultAppVariables())
+		config.DefaultAppVariables(),
+		nil,
+		nil)
 	indexEndpoint, isType := endpoint.(CspIndexEndpoint)
 	test.AssertTrue(t, isType)
 	test.AssertEqual(
@@ -149,7 +175,9 @@ func TestIndexEndpoint_withCsp_customHtml(t *testing.T) {
 func TestRootEndpoint(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("i18n")
-	endpoint := ResolveRootEndpoint(context.Path, "")
+	locales, err := ResolveLocales(context.Path, nil)
+	test.AssertNoError(t, err)
+	endpoint := ResolveRootEndpoint(locales, "", nil)
 	rootEndpoint, isType := endpoint.(RootEndpoint)
 	test.AssertTrue(t, isType)
 	expectedLanguages := []string{"de-CH", "en-US", "fr"}
@@ -159,7 +187,9 @@ func TestRootEndpoint(t *testing.T) {
 func TestRootEndpoint_withEmptyDefault(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("i18n")
-	endpoint := ResolveRootEndpoint(context.Path, "")
+	locales, err := ResolveLocales(context.Path, nil)
+	test.AssertNoError(t, err)
+	endpoint := ResolveRootEndpoint(locales, "", nil)
 	rootEndpoint, isType := endpoint.(RootEndpoint)
 	test.AssertTrue(t, isType)
 	test.AssertEqual(t, rootEndpoint.DefaultPath, "de-CH")
@@ -168,7 +198,9 @@ func TestRootEndpoint_withEmptyDefault(t *testing.T) {
 func TestRootEndpoint_withMissingDefault(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("i18n")
-	endpoint := ResolveRootEndpoint(context.Path, "lol")
+	locales, err := ResolveLocales(context.Path, nil)
+	test.AssertNoError(t, err)
+	endpoint := ResolveRootEndpoint(locales, "lol", nil)
 	rootEndpoint, isType := endpoint.(RootEndpoint)
 	test.AssertTrue(t, isType)
 	test.AssertEqual(t, rootEndpoint.DefaultPath, "de-CH")
@@ -177,7 +209,9 @@ func TestRootEndpoint_withMissingDefault(t *testing.T) {
 func TestRootEndpoint_withDefault(t *testing.T) {
 	context := test.NewTestDir(t)
 	context.ImportTestApp("i18n")
-	endpoint := ResolveRootEndpoint(context.Path, "en-US")
+	locales, err := ResolveLocales(context.Path, nil)
+	test.AssertNoError(t, err)
+	endpoint := ResolveRootEndpoint(locales, "en-US", nil)
 	rootEndpoint, isType := endpoint.(RootEndpoint)
 	test.AssertTrue(t, isType)
 	test.AssertEqual(t, rootEndpoint.DefaultPath, "en-US")
@@ -1,46 +1,133 @@
 package endpoints
 
 import (
-	"fmt"
 	"net/http"
+	"ngstaticserver/serve/headers"
 	"strings"
 )
 
+const (
+	// LocaleQueryParameter allows to explicitly select a locale (e.g. /?lang=fr).
+	LocaleQueryParameter = "lang"
+	// LocaleCookie stores the locale which was explicitly selected.
+	LocaleCookie = "ngss_lang"
+	// localeCookieMaxAge keeps the selected locale for a year.
+	localeCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+const (
+	// I18nPrefixAlways serves every locale with its prefix and redirects
+	// unprefixed paths to the matching locale.
+	I18nPrefixAlways = "always"
+	// I18nPrefixOptional serves the default locale with and without its prefix.
+	I18nPrefixOptional = "optional"
+	// I18nPrefixNever serves the default locale without its prefix and
+	// redirects prefixed paths of the default locale to the unprefixed form.
+	I18nPrefixNever = "never"
+)
+
 type RootEndpoint struct {
 	DefaultPath    string
 	AvailablePaths []string
+	// DefaultEndpoint serves the default locale at unprefixed paths. If nil,
+	// unprefixed paths are redirected to the matching locale.
+	DefaultEndpoint Endpoint
+	// Hosts selects the locale by the requested host, if configured.
+	Hosts *HostLocales
 }
 
+// Handle redirects to the matching locale, while preserving the requested
+// path and query (e.g. /products/42?ref=mail to /de/products/42?ref=mail).
+// The locale is selected by the lang query parameter, the locale cookie, the
+// requested host or the Accept-Language header, in that order. If the default
+// locale is served unprefixed, the Accept-Language header is not evaluated.
 func (endpoint RootEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
-	acceptLanguage := strings.Split(r.Header.Get("Accept-Language"), ",")
-	if match := endpoint.MatchLanguage(acceptLanguage); match != "" {
-		w.Header().Set("Location", fmt.Sprintf("/%v", match))
-		w.WriteHeader(http.StatusTemporaryRedirect)
-	} else {
+	if len(endpoint.AvailablePaths) == 0 {
+		w.Header().Add("Vary", "Accept-Language, Cookie")
 		w.WriteHeader(http.StatusNotFound)
+		return
 	}
-}
 
-func (endpoint RootEndpoint) MatchLanguage(languages []string) string {
-	if len(endpoint.AvailablePaths) == 0 {
-		return ""
+	locale, rawQuery := endpoint.selectLocale(w, r)
+	if endpoint.DefaultEndpoint != nil {
+		w.Header().Add("Vary", "Cookie")
+		if len(locale) == 0 || locale == endpoint.DefaultPath {
+			endpoint.DefaultEndpoint.Handle(w, r, p)
+			return
+		}
+	} else {
+		w.Header().Add("Vary", "Accept-Language, Cookie")
+		if len(locale) == 0 {
+			locale = endpoint.MatchLanguage(headers.ResolveAcceptLanguage(r))
+		}
 	}
 
-	for _, l := range languages {
-		for _, a := range endpoint.AvailablePaths {
-			if l == a {
-				return l
-			}
-		}
+	location := "/" + locale
+	if path := r.URL.EscapedPath(); path != "/" && len(path) > 0 {
+		location += "/" + strings.TrimLeft(path, "/")
+	}
+	if len(rawQuery) > 0 {
+		location += "?" + rawQuery
 	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusTemporaryRedirect)
+}
 
-	for _, l := range languages {
-		for _, a := range endpoint.AvailablePaths {
-			if strings.HasPrefix(a, l) || strings.HasPrefix(l, a) {
-				return a
-			}
+// selectLocale returns the locale explicitly selected via the lang query
+// parameter (which is then stored in the cookie and removed from the
+// returned query) or the cookie, or the locale mapped to the requested host.
+func (endpoint RootEndpoint) selectLocale(w http.ResponseWriter, r *http.Request) (string, string) {
+	rawQuery := r.URL.RawQuery
+	locale := ""
+	if query := r.URL.Query(); len(query.Get(LocaleQueryParameter)) > 0 {
+		if match, ok := headers.LookupTag(query.Get(LocaleQueryParameter), endpoint.AvailablePaths); ok {
+			locale = match
+			query.Del(LocaleQueryParameter)
+			rawQuery = query.Encode()
+			http.SetCookie(w, &http.Cookie{
+				Name:     LocaleCookie,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   localeCookieMaxAge,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
 		}
 	}
+	if cookie, err := r.Cookie(LocaleCookie); len(locale) == 0 && err == nil {
+		locale, _ = headers.LookupTag(cookie.Value, endpoint.AvailablePaths)
+	}
+	if hostLocale, ok := endpoint.Hosts.Lookup(r); len(locale) == 0 && ok {
+		locale, _ = headers.LookupTag(hostLocale, endpoint.AvailablePaths)
+	}
+
+	return locale, rawQuery
+}
+
+func (endpoint RootEndpoint) MatchLanguage(acceptLanguage headers.AcceptLanguage) string {
+	if len(endpoint.AvailablePaths) == 0 {
+		return ""
+	} else if match, ok := acceptLanguage.Lookup(endpoint.AvailablePaths); ok {
+		return match
+	}
 
 	return endpoint.DefaultPath
 }
+
+// PrefixRedirectEndpoint permanently redirects the prefixed paths of the
+// default locale to their unprefixed form (e.g. /de/products?id=1 to
+// /products?id=1).
+type PrefixRedirectEndpoint struct {
+	Prefix string
+}
+
+func (endpoint PrefixRedirectEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
+	// Leading slashes are collapsed, as //host would be a redirect to
+	// another host.
+	location := "/" + strings.TrimLeft(strings.TrimPrefix(r.URL.EscapedPath(), "/"+endpoint.Prefix), "/")
+	if len(r.URL.RawQuery) > 0 {
+		location += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
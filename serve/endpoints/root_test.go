@@ -8,7 +8,7 @@ import (
 )
 
 func TestRootRequest_notFound(t *testing.T) {
-	handler := RootEndpoint{"de-CH", []string{}}
+	handler := RootEndpoint{"de-CH", []string{}, nil, nil}
 	req := httptest.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	handler.Handle(w, req, make(map[string]string))
@@ -19,7 +19,7 @@ func TestRootRequest_notFound(t *testing.T) {
 }
 
 func TestRootRequest_default(t *testing.T) {
-	handler := RootEndpoint{"de-CH", []string{"de-CH"}}
+	handler := RootEndpoint{"de-CH", []string{"de-CH"}, nil, nil}
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Add("Accept-Language", "en-US")
 	w := httptest.NewRecorder()
@@ -32,7 +32,7 @@ func TestRootRequest_default(t *testing.T) {
 }
 
 func TestRootRequest_exactMatch(t *testing.T) {
-	handler := RootEndpoint{"de", []string{"de"}}
+	handler := RootEndpoint{"de", []string{"de"}, nil, nil}
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Add("Accept-Language", "de")
 	w := httptest.NewRecorder()
@@ -45,7 +45,7 @@ func TestRootRequest_exactMatch(t *testing.T) {
 }
 
 func TestRootRequest_partialMatch(t *testing.T) {
-	handler := RootEndpoint{"de", []string{"de"}}
+	handler := RootEndpoint{"de", []string{"de"}, nil, nil}
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Add("Accept-Language", "de-CH")
 	w := httptest.NewRecorder()
@@ -58,7 +58,7 @@ func TestRootRequest_partialMatch(t *testing.T) {
 }
 
 func TestRootRequest_partialMatchReversed(t *testing.T) {
-	handler := RootEndpoint{"de-CH", []string{"de-CH"}}
+	handler := RootEndpoint{"de-CH", []string{"de-CH"}, nil, nil}
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Add("Accept-Language", "de")
 	w := httptest.NewRecorder()
@@ -69,3 +69,147 @@ func TestRootRequest_partialMatchReversed(t *testing.T) {
 	test.AssertEqual(t, resp.StatusCode, http.StatusTemporaryRedirect)
 	test.AssertEqual(t, resp.Header.Get("Location"), "/de-CH")
 }
+
+func TestRootRequest_quality(t *testing.T) {
+	handler := RootEndpoint{"de", []string{"de", "en", "fr"}, nil, nil}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Language", "de;q=0.5, fr-CH, en;q=0.8")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, http.StatusTemporaryRedirect)
+	test.AssertEqual(t, resp.Header.Get("Location"), "/fr")
+	test.AssertEqual(t, resp.Header.Get("Vary"), "Accept-Language, Cookie")
+}
+
+func TestRootRequest_rejected(t *testing.T) {
+	handler := RootEndpoint{"en", []string{"de", "en"}, nil, nil}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Language", "de;q=0, fr")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/en")
+}
+
+func TestRootRequest_subtagBoundary(t *testing.T) {
+	handler := RootEndpoint{"fr", []string{"default", "en", "fr"}, nil, nil}
+	for _, language := range []string{"e", "de"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Accept-Language", language)
+		w := httptest.NewRecorder()
+		handler.Handle(w, req, make(map[string]string))
+
+		test.AssertEqual(t, w.Result().Header.Get("Location"), "/fr")
+	}
+}
+
+func TestRootRequest_preservesPathAndQuery(t *testing.T) {
+	handler := RootEndpoint{"de", []string{"de"}, nil, nil}
+	req := httptest.NewRequest("GET", "/products/42?ref=mail", nil)
+	req.Header.Add("Accept-Language", "de-CH")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, map[string]string{"filepath": "products/42"})
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, http.StatusTemporaryRedirect)
+	test.AssertEqual(t, resp.Header.Get("Location"), "/de/products/42?ref=mail")
+}
+
+func TestRootRequest_queryOverride(t *testing.T) {
+	handler := RootEndpoint{"de", []string{"de", "fr"}, nil, nil}
+	req := httptest.NewRequest("GET", "/products?lang=fr-CH&ref=mail", nil)
+	req.Header.Add("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.Header.Get("Location"), "/fr/products?ref=mail")
+	cookies := resp.Cookies()
+	test.AssertEqual(t, len(cookies), 1)
+	test.AssertEqual(t, cookies[0].Name, LocaleCookie)
+	test.AssertEqual(t, cookies[0].Value, "fr")
+}
+
+func TestRootRequest_cookieOverride(t *testing.T) {
+	handler := RootEndpoint{"de", []string{"de", "fr"}, nil, nil}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Language", "de")
+	req.AddCookie(&http.Cookie{Name: LocaleCookie, Value: "fr"})
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.Header.Get("Location"), "/fr")
+	test.AssertEqual(t, len(resp.Cookies()), 0)
+}
+
+func TestRootRequest_defaultEndpoint(t *testing.T) {
+	handler := RootEndpoint{"de", []string{"de", "fr"}, InlineStringEndpoint{"index.html", []byte("de")}, nil}
+	req := httptest.NewRequest("GET", "/products/42", nil)
+	req.Header.Add("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, http.StatusOK)
+	test.AssertEqual(t, w.Body.String(), "de")
+	test.AssertEqual(t, resp.Header.Get("Vary"), "Cookie")
+}
+
+func TestRootRequest_defaultEndpointCookieOverride(t *testing.T) {
+	handler := RootEndpoint{"de", []string{"de", "fr"}, InlineStringEndpoint{"index.html", []byte("de")}, nil}
+	req := httptest.NewRequest("GET", "/products/42", nil)
+	req.AddCookie(&http.Cookie{Name: LocaleCookie, Value: "fr"})
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, http.StatusTemporaryRedirect)
+	test.AssertEqual(t, resp.Header.Get("Location"), "/fr/products/42")
+}
+
+func TestPrefixRedirect(t *testing.T) {
+	handler := PrefixRedirectEndpoint{"de"}
+	for path, location := range map[string]string{
+		"/de":               "/",
+		"/de/":              "/",
+		"/de/products?id=1": "/products?id=1",
+		"/de//evil.com":     "/evil.com",
+		"/de///evil.com/x":  "/evil.com/x",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		handler.Handle(w, req, make(map[string]string))
+
+		resp := w.Result()
+
+		test.AssertEqual(t, resp.StatusCode, http.StatusMovedPermanently)
+		test.AssertEqual(t, resp.Header.Get("Location"), location)
+	}
+}
+
+func TestRootRequest_host(t *testing.T) {
+	hosts := &HostLocales{Hosts: []HostLocale{{"example.de", "de"}, {"example.fr", "fr"}}}
+	handler := RootEndpoint{"de", []string{"de", "fr"}, nil, hosts}
+	req := httptest.NewRequest("GET", "http://example.fr/products", nil)
+	req.Header.Add("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/fr/products")
+
+	req = httptest.NewRequest("GET", "http://example.fr/products", nil)
+	req.AddCookie(&http.Cookie{Name: LocaleCookie, Value: "de"})
+	w = httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/de/products")
+}
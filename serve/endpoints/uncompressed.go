@@ -2,7 +2,8 @@ package endpoints
 
 import (
 	"net/http"
-	"os"
+	"ngstaticserver/serve/cache"
+	"ngstaticserver/serve/headers"
 	"time"
 )
 
@@ -10,11 +11,24 @@ type UncompressedFileEndpoint struct {
 	Path         string
 	ModTime      time.Time
 	CacheControl string
+	Cache        *cache.AssetCache
+	ETags        ETags
 }
 
 func (endpoint UncompressedFileEndpoint) Handle(w http.ResponseWriter, r *http.Request, p map[string]string) {
-	f, _ := os.Open(endpoint.Path)
+	if !headers.ResolveAcceptEncoding(r).AllowsIdentity() {
+		notAcceptable(w)
+		return
+	}
+	f, err := endpoint.Cache.Open(endpoint.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
 	defer f.Close()
+	if etag, ok := endpoint.ETags[""]; ok {
+		w.Header().Set("ETag", etag)
+	}
 	w.Header().Set("Cache-Control", endpoint.CacheControl)
 	http.ServeContent(w, r, endpoint.Path, endpoint.ModTime, f)
 }
@@ -64,8 +64,32 @@ func TestFileRequestGzip_uncompressed(t *testing.T) {
 	test.AssertEqual(t, string(body), content)
 }
 
+func TestFileRequestRemoved_uncompressed(t *testing.T) {
+	context, handler := createTestContext_uncompressed(t)
+	context.RemoveFile(File)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, 404)
+}
+
 func createTestContext_uncompressed(t *testing.T) (test.TestDir, Endpoint) {
 	context := test.NewTestDir(t)
 	context.WriteFile(File, strings.Repeat("example", 10))
-	return context, UncompressedFileEndpoint{filepath.Join(context.Path, File), time.Now(), "no-store"}
+	return context, UncompressedFileEndpoint{filepath.Join(context.Path, File), time.Now(), "no-store", nil, nil}
+}
+
+func TestFileRequestNotAcceptable_uncompressed(t *testing.T) {
+	_, handler := createTestContext_uncompressed(t)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", File), nil)
+	req.Header.Add("Accept-Encoding", "*;q=0")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req, make(map[string]string))
+
+	test.AssertEqual(t, w.Result().StatusCode, 406)
 }
@@ -0,0 +1,24 @@
+package endpoints
+
+import (
+	"net/http"
+)
+
+// setVariantHeaders marks the response as negotiated via Accept-Encoding and
+// sets the Content-Encoding and ETag of the selected variant.
+func setVariantHeaders(w http.ResponseWriter, encoding, etag string) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+// notAcceptable answers a request, for which neither a variant nor the
+// uncompressed file is acceptable according to its Accept-Encoding header.
+func notAcceptable(w http.ResponseWriter) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+}
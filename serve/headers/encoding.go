@@ -1,7 +1,10 @@
 package headers
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -11,29 +14,101 @@ const (
 	NO_COMPRESSION = 0
 	GZIP           = 1 << iota
 	BROTLI
+	ZSTD
 )
 
-type AcceptEncoding struct {
-	acceptEncoding Encoding
+// DefaultPreference is the order in which the server picks an encoding,
+// if the client accepts more than one of the available encodings.
+var DefaultPreference = []Encoding{ZSTD, BROTLI, GZIP}
+
+// Coding is a content coding accepted by the client with its weight.
+type Coding struct {
+	Encoding Encoding
+	Quality  float64
 }
 
+// AcceptEncoding contains the content codings supported by the server, which
+// are acceptable to the client, ranked by their weight. The identity
+// (NO_COMPRESSION) is contained, unless it has been excluded.
+type AcceptEncoding []Coding
+
+// The identity is acceptable even if it is not listed, but only if no other
+// acceptable coding is available.
+const implicitIdentityQuality = 0.001
+
+var codingNames = map[string]Encoding{
+	"identity": NO_COMPRESSION,
+	"br":       BROTLI,
+	"gzip":     GZIP,
+	"x-gzip":   GZIP,
+	"zstd":     ZSTD,
+}
+
+// ResolveAcceptEncoding parses the Accept-Encoding header according to
+// RFC 9110 (https://www.rfc-editor.org/rfc/rfc9110#name-accept-encoding).
+// Explicitly listed codings take precedence over *, codings with q=0 are not
+// acceptable and unknown codings or invalid weights are ignored.
 func ResolveAcceptEncoding(r *http.Request) AcceptEncoding {
-	acceptEncoding := r.Header.Values("Accept-Encoding")
-	var resultEncoding Encoding
-	for _, entry := range acceptEncoding {
+	explicit := make(map[Encoding]float64)
+	wildcard := -1.0
+	for _, entry := range r.Header.Values("Accept-Encoding") {
 		for _, part := range strings.Split(entry, ",") {
-			part = strings.TrimSpace(part)
-			if part == "*" {
-				return AcceptEncoding{acceptEncoding: BROTLI | GZIP}
-			} else if part == "br" {
-				resultEncoding = resultEncoding ^ BROTLI
-			} else if part == "gzip" {
-				resultEncoding = resultEncoding ^ GZIP
+			name, quality, ok := parseWeightedValue(part)
+			if !ok {
+				continue
+			} else if name == "*" {
+				wildcard = max(wildcard, quality)
+			} else if encoding, known := codingNames[name]; known {
+				if existing, duplicate := explicit[encoding]; !duplicate || quality > existing {
+					explicit[encoding] = quality
+				}
 			}
 		}
 	}
 
-	return AcceptEncoding{acceptEncoding: resultEncoding}
+	accepted := make(AcceptEncoding, 0, 4)
+	for _, encoding := range []Encoding{ZSTD, BROTLI, GZIP, NO_COMPRESSION} {
+		quality, listed := explicit[encoding]
+		if !listed && wildcard >= 0 {
+			quality, listed = wildcard, true
+		}
+		if !listed && encoding == NO_COMPRESSION {
+			quality, listed = implicitIdentityQuality, true
+		}
+		if listed && quality > 0 {
+			accepted = append(accepted, Coding{encoding, quality})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].Quality > accepted[j].Quality
+	})
+
+	return accepted
+}
+
+// parseWeightedValue parses an element of a header with weights (e.g.
+// gzip;q=0.8) into its lowercase value and weight.
+func parseWeightedValue(part string) (string, float64, bool) {
+	name, parameters, _ := strings.Cut(part, ";")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return "", 0, false
+	}
+
+	quality := 1.0
+	for _, parameter := range strings.Split(parameters, ";") {
+		key, value, _ := strings.Cut(parameter, "=")
+		if !strings.EqualFold(strings.TrimSpace(key), "q") {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return "", 0, false
+		}
+		quality = parsed
+	}
+
+	return name, quality, true
 }
 
 func (encoding Encoding) ContainsBrotli() bool {
@@ -44,14 +119,128 @@ func (encoding Encoding) ContainsGzip() bool {
 	return encoding&GZIP != 0
 }
 
+func (encoding Encoding) ContainsZstd() bool {
+	return encoding&ZSTD != 0
+}
+
 func (encoding Encoding) NoCompression() bool {
 	return encoding == NO_COMPRESSION
 }
 
 func (encoding AcceptEncoding) AllowsBrotli() bool {
-	return encoding.acceptEncoding.ContainsBrotli()
+	return encoding.Allows(BROTLI)
 }
 
 func (encoding AcceptEncoding) AllowsGzip() bool {
-	return encoding.acceptEncoding.ContainsGzip()
+	return encoding.Allows(GZIP)
+}
+
+func (encoding AcceptEncoding) AllowsZstd() bool {
+	return encoding.Allows(ZSTD)
+}
+
+func (encoding AcceptEncoding) AllowsIdentity() bool {
+	return encoding.Allows(NO_COMPRESSION)
+}
+
+func (encoding AcceptEncoding) Allows(candidate Encoding) bool {
+	for _, coding := range encoding {
+		if coding.Encoding == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Negotiate picks the available encoding with the highest weight. Ties are
+// resolved by the preference order, which is preferred over the identity.
+// Encodings missing in the preference order are never picked and a nil
+// preference uses the DefaultPreference. If neither an encoding nor the
+// identity is acceptable, false is returned (i.e. 406 Not Acceptable).
+func (encoding AcceptEncoding) Negotiate(available Encoding, preference []Encoding) (Encoding, bool) {
+	if preference == nil {
+		preference = DefaultPreference
+	}
+	rank := func(candidate Encoding) int {
+		for i, preferred := range preference {
+			if preferred == candidate {
+				return i
+			}
+		}
+		if candidate == NO_COMPRESSION {
+			return len(preference)
+		}
+		return -1
+	}
+
+	var result Coding
+	found := false
+	for _, coding := range encoding {
+		if found && coding.Quality < result.Quality {
+			break
+		} else if rank(coding.Encoding) < 0 || (coding.Encoding != NO_COMPRESSION && available&coding.Encoding == 0) {
+			continue
+		} else if !found || rank(coding.Encoding) < rank(result.Encoding) {
+			result = coding
+			found = true
+		}
+	}
+
+	return result.Encoding, found
+}
+
+// Name returns the Content-Encoding token of a single encoding.
+func (encoding Encoding) Name() string {
+	switch encoding {
+	case BROTLI:
+		return "br"
+	case GZIP:
+		return "gzip"
+	case ZSTD:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// Extension returns the file extension of the pre-compressed variant of a
+// single encoding.
+func (encoding Encoding) Extension() string {
+	switch encoding {
+	case BROTLI:
+		return ".br"
+	case GZIP:
+		return ".gz"
+	case ZSTD:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// ParsePreference parses a list of Content-Encoding tokens (e.g. zstd, br,
+// gzip) into a preference order.
+func ParsePreference(names []string) ([]Encoding, error) {
+	preference := make([]Encoding, 0, len(names))
+	var seen Encoding
+	for _, name := range names {
+		var encoding Encoding
+		switch strings.TrimSpace(name) {
+		case "br":
+			encoding = BROTLI
+		case "gzip":
+			encoding = GZIP
+		case "zstd":
+			encoding = ZSTD
+		default:
+			return nil, fmt.Errorf("invalid encoding %v (must either be zstd, br or gzip)", name)
+		}
+		if seen&encoding == 0 {
+			seen |= encoding
+			preference = append(preference, encoding)
+		}
+	}
+
+	return preference, nil
 }
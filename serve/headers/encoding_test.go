@@ -10,7 +10,8 @@ func TestAcceptEncodingResolvingStar(t *testing.T) {
 	encoding := ResolveAcceptEncoding(createRequest("*"))
 	test.AssertTrue(t, encoding.AllowsBrotli())
 	test.AssertTrue(t, encoding.AllowsGzip())
-	test.AssertTrue(t, !encoding.acceptEncoding.NoCompression())
+	test.AssertTrue(t, encoding.AllowsZstd())
+	test.AssertTrue(t, encoding.AllowsIdentity())
 }
 
 func TestAcceptEncodingResolvingBrotliAndGzip(t *testing.T) {
@@ -52,3 +53,100 @@ func createRequest(acceptEncoding ...string) *http.Request {
 		Header: header,
 	}
 }
+
+func TestAcceptEncodingResolvingZstd(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("gzip, zstd"))
+	test.AssertTrue(t, encoding.AllowsZstd())
+	test.AssertTrue(t, encoding.AllowsGzip())
+	test.AssertTrue(t, !encoding.AllowsBrotli())
+}
+
+func TestAcceptEncodingResolvingQuality(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("gzip;q=0.5, BR;Q=1.0, zstd;q=0.8"))
+	test.AssertEqual(t, len(encoding), 4)
+	test.AssertEqual(t, encoding[0], Coding{BROTLI, 1})
+	test.AssertEqual(t, encoding[1], Coding{ZSTD, 0.8})
+	test.AssertEqual(t, encoding[2], Coding{GZIP, 0.5})
+	test.AssertEqual(t, encoding[3], Coding{NO_COMPRESSION, implicitIdentityQuality})
+}
+
+func TestAcceptEncodingResolvingRejection(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("*, gzip;q=0"))
+	test.AssertTrue(t, encoding.AllowsBrotli())
+	test.AssertTrue(t, encoding.AllowsZstd())
+	test.AssertTrue(t, !encoding.AllowsGzip())
+	test.AssertTrue(t, encoding.AllowsIdentity())
+}
+
+func TestAcceptEncodingResolvingIdentity(t *testing.T) {
+	test.AssertTrue(t, ResolveAcceptEncoding(createRequest("")).AllowsIdentity())
+	test.AssertTrue(t, ResolveAcceptEncoding(createRequest("*;q=0, identity")).AllowsIdentity())
+	test.AssertTrue(t, !ResolveAcceptEncoding(createRequest("br, identity;q=0")).AllowsIdentity())
+	encoding := ResolveAcceptEncoding(createRequest("*;q=0"))
+	test.AssertEqual(t, len(encoding), 0)
+}
+
+func TestAcceptEncodingResolvingDuplicates(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("br", "br;q=0.5", "br"))
+	test.AssertTrue(t, encoding.AllowsBrotli())
+	test.AssertEqual(t, encoding[0], Coding{BROTLI, 1})
+}
+
+func TestAcceptEncodingResolvingRepeated(t *testing.T) {
+	// A coding listed twice stays acceptable
+	encoding := ResolveAcceptEncoding(createRequest("gzip, br", "gzip"))
+	test.AssertTrue(t, encoding.AllowsGzip())
+	test.AssertTrue(t, encoding.AllowsBrotli())
+	encoding = ResolveAcceptEncoding(createRequest("br, br"))
+	test.AssertTrue(t, encoding.AllowsBrotli())
+}
+
+func TestAcceptEncodingResolvingInvalidQuality(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("br;q=2, gzip;q=abc, zstd;q=0.1"))
+	test.AssertTrue(t, !encoding.AllowsBrotli())
+	test.AssertTrue(t, !encoding.AllowsGzip())
+	test.AssertTrue(t, encoding.AllowsZstd())
+}
+
+func TestAcceptEncodingNegotiate(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("gzip, br, zstd"))
+	assertNegotiation(t, encoding, BROTLI|GZIP|ZSTD, nil, ZSTD, true)
+	assertNegotiation(t, encoding, BROTLI|GZIP, nil, BROTLI, true)
+	assertNegotiation(t, encoding, BROTLI|GZIP|ZSTD, []Encoding{GZIP, BROTLI}, GZIP, true)
+	assertNegotiation(t, encoding, ZSTD, []Encoding{GZIP, BROTLI}, NO_COMPRESSION, true)
+	assertNegotiation(t, ResolveAcceptEncoding(createRequest()), BROTLI|GZIP|ZSTD, nil, NO_COMPRESSION, true)
+}
+
+func TestAcceptEncodingNegotiateQuality(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("zstd;q=0.5, br;q=0.9, gzip"))
+	assertNegotiation(t, encoding, BROTLI|GZIP|ZSTD, nil, GZIP, true)
+	assertNegotiation(t, encoding, BROTLI|ZSTD, nil, BROTLI, true)
+	assertNegotiation(t, encoding, ZSTD, nil, ZSTD, true)
+	assertNegotiation(t, encoding, NO_COMPRESSION, nil, NO_COMPRESSION, true)
+}
+
+func TestAcceptEncodingNegotiateNotAcceptable(t *testing.T) {
+	encoding := ResolveAcceptEncoding(createRequest("br, identity;q=0"))
+	assertNegotiation(t, encoding, BROTLI|GZIP, nil, BROTLI, true)
+	assertNegotiation(t, encoding, GZIP, nil, NO_COMPRESSION, false)
+	assertNegotiation(t, ResolveAcceptEncoding(createRequest("*;q=0")), BROTLI, nil, NO_COMPRESSION, false)
+}
+
+func assertNegotiation(t *testing.T, encoding AcceptEncoding, available Encoding, preference []Encoding, expected Encoding, expectedOk bool) {
+	t.Helper()
+	result, ok := encoding.Negotiate(available, preference)
+	test.AssertEqual(t, result, expected)
+	test.AssertEqual(t, ok, expectedOk)
+}
+
+func TestParsePreference(t *testing.T) {
+	preference, err := ParsePreference([]string{"br", " zstd", "br", "gzip"})
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, len(preference), 3)
+	test.AssertEqual(t, preference[0], Encoding(BROTLI))
+	test.AssertEqual(t, preference[1], Encoding(ZSTD))
+	test.AssertEqual(t, preference[2], Encoding(GZIP))
+
+	_, err = ParsePreference([]string{"deflate"})
+	test.AssertTrue(t, err != nil)
+}
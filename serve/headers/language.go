@@ -0,0 +1,91 @@
+package headers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// LanguageRange is a language range accepted by the client with its weight.
+type LanguageRange struct {
+	Tag     string
+	Quality float64
+}
+
+// AcceptLanguage contains the language ranges of the Accept-Language header,
+// ranked by their weight. Ranges with q=0 are omitted.
+type AcceptLanguage []LanguageRange
+
+func ResolveAcceptLanguage(r *http.Request) AcceptLanguage {
+	accepted := make(AcceptLanguage, 0)
+	for _, entry := range r.Header.Values("Accept-Language") {
+		for _, part := range strings.Split(entry, ",") {
+			tag, quality, ok := parseWeightedValue(part)
+			if ok && quality > 0 {
+				accepted = append(accepted, LanguageRange{tag, quality})
+			}
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].Quality > accepted[j].Quality
+	})
+
+	return accepted
+}
+
+// Lookup returns the best matching tag for the language ranges in the order
+// of their weight. Each range is first matched according to the lookup scheme
+// of RFC 4647 (https://www.rfc-editor.org/rfc/rfc4647#section-3.4), where the
+// range is truncated until it matches a tag (e.g. de-CH-1996 matches de-CH
+// or de). If that fails, the range matches the first tag it is a prefix of
+// (e.g. de matches de-CH). Subtags are always compared as a whole, so that
+// e does not match en.
+func (accept AcceptLanguage) Lookup(tags []string) (string, bool) {
+	for _, languageRange := range accept {
+		if tag, ok := LookupTag(languageRange.Tag, tags); ok {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
+
+// LookupTag matches a single language range against the available tags
+// (see AcceptLanguage.Lookup).
+func LookupTag(languageRange string, tags []string) (string, bool) {
+	languageRange = strings.ToLower(strings.TrimSpace(languageRange))
+	if languageRange == "*" || len(languageRange) == 0 {
+		return "", false
+	}
+
+	for truncated := languageRange; len(truncated) > 0; truncated = truncateLanguageRange(truncated) {
+		for _, tag := range tags {
+			if strings.EqualFold(tag, truncated) {
+				return tag, true
+			}
+		}
+	}
+
+	for _, tag := range tags {
+		if strings.HasPrefix(strings.ToLower(tag), languageRange+"-") {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
+
+// truncateLanguageRange removes the last subtag of the range and any
+// single-character subtag (e.g. the x of a private use sequence) preceding it.
+func truncateLanguageRange(languageRange string) string {
+	index := strings.LastIndex(languageRange, "-")
+	if index < 0 {
+		return ""
+	}
+	languageRange = languageRange[:index]
+	if index := strings.LastIndex(languageRange, "-"); index >= 0 && len(languageRange)-index == 2 {
+		languageRange = languageRange[:index]
+	}
+
+	return languageRange
+}
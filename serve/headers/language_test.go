@@ -0,0 +1,46 @@
+package headers
+
+import (
+	"net/http"
+	"ngstaticserver/test"
+	"testing"
+)
+
+func TestAcceptLanguageResolving(t *testing.T) {
+	accept := ResolveAcceptLanguage(createLanguageRequest("de-CH, en;q=0.9, fr;q=0, *;q=0.1"))
+	test.AssertEqual(t, len(accept), 3)
+	test.AssertEqual(t, accept[0], LanguageRange{"de-ch", 1})
+	test.AssertEqual(t, accept[1], LanguageRange{"en", 0.9})
+	test.AssertEqual(t, accept[2], LanguageRange{"*", 0.1})
+}
+
+func TestAcceptLanguageLookup(t *testing.T) {
+	tags := []string{"de", "en-US", "fr-CH"}
+	assertLookup(t, "de-CH-1996", tags, "de", true)
+	assertLookup(t, "EN-us", tags, "en-US", true)
+	assertLookup(t, "en", tags, "en-US", true)
+	assertLookup(t, "fr-x-private", tags, "", false)
+	assertLookup(t, "fr-CH-x-private", tags, "fr-CH", true)
+	assertLookup(t, "e", tags, "", false)
+	assertLookup(t, "*", tags, "", false)
+}
+
+func TestAcceptLanguageLookupByWeight(t *testing.T) {
+	accept := ResolveAcceptLanguage(createLanguageRequest("it, de;q=0.5, en;q=0.8"))
+	tag, ok := accept.Lookup([]string{"de", "en"})
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, tag, "en")
+}
+
+func assertLookup(t *testing.T, languageRange string, tags []string, expected string, expectedOk bool) {
+	t.Helper()
+	tag, ok := LookupTag(languageRange, tags)
+	test.AssertEqual(t, tag, expected)
+	test.AssertEqual(t, ok, expectedOk)
+}
+
+func createLanguageRequest(acceptLanguage string) *http.Request {
+	return &http.Request{
+		Header: http.Header{"Accept-Language": []string{acceptLanguage}},
+	}
+}
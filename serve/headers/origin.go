@@ -0,0 +1,96 @@
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Origin resolves the scheme and host under which the server is reachable,
+// e.g. to build absolute URLs.
+type Origin struct {
+	// Canonical is used for every request, if configured (e.g. https://example.com).
+	Canonical string
+	// TrustForwarded enables the Forwarded and X-Forwarded-Proto/X-Forwarded-Host
+	// headers, which must only be trusted behind a proxy setting them.
+	TrustForwarded bool
+}
+
+var hostRegex = regexp.MustCompile(`^(?:[A-Za-z0-9.\-]+|\[[0-9A-Fa-f:.]+\])(?::[0-9]+)?$`)
+
+// ParseOrigin validates a canonical origin, which must consist of an http(s)
+// scheme and a host only.
+func ParseOrigin(value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	origin, err := url.Parse(strings.TrimSuffix(value, "/"))
+	if err != nil || (origin.Scheme != "http" && origin.Scheme != "https") || !hostRegex.MatchString(origin.Host) ||
+		len(origin.Path) > 0 || len(origin.RawQuery) > 0 || len(origin.Fragment) > 0 || origin.User != nil {
+		return "", fmt.Errorf("invalid origin %v (expected e.g. https://example.com)", value)
+	}
+
+	return origin.Scheme + "://" + origin.Host, nil
+}
+
+// Resolve returns the origin of the request (e.g. https://example.com). The
+// canonical origin takes precedence over the request (see ResolveHost).
+func (origin Origin) Resolve(r *http.Request) string {
+	if len(origin.Canonical) > 0 {
+		return origin.Canonical
+	}
+
+	scheme, host := origin.ResolveHost(r)
+	return scheme + "://" + host
+}
+
+// ResolveHost returns the scheme and host of the request, which are read
+// from the trusted forwarded headers or the Host header.
+func (origin Origin) ResolveHost(r *http.Request) (string, string) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if origin.TrustForwarded {
+		forwardedScheme, forwardedHost := resolveForwarded(r)
+		if forwardedScheme == "http" || forwardedScheme == "https" {
+			scheme = forwardedScheme
+		}
+		if hostRegex.MatchString(forwardedHost) {
+			host = forwardedHost
+		}
+	}
+
+	return scheme, host
+}
+
+// resolveForwarded reads the scheme and host set by the closest proxy from
+// the Forwarded header (https://www.rfc-editor.org/rfc/rfc7239) or the
+// X-Forwarded-Proto and X-Forwarded-Host headers.
+func resolveForwarded(r *http.Request) (string, string) {
+	if forwarded := r.Header.Get("Forwarded"); len(forwarded) > 0 {
+		scheme, host := "", ""
+		element, _, _ := strings.Cut(forwarded, ",")
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "proto":
+				scheme = strings.ToLower(value)
+			case "host":
+				host = value
+			}
+		}
+		return scheme, host
+	}
+
+	scheme, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	host, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	return strings.ToLower(strings.TrimSpace(scheme)), strings.TrimSpace(host)
+}
@@ -0,0 +1,53 @@
+package headers
+
+import (
+	"net/http/httptest"
+	"ngstaticserver/test"
+	"testing"
+)
+
+func TestOriginCanonical(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	req.Header.Set("X-Forwarded-Host", "proxy.example.com")
+	origin := Origin{"https://example.com", true}
+	test.AssertEqual(t, origin.Resolve(req), "https://example.com")
+}
+
+func TestOriginHost(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "example.com")
+	test.AssertEqual(t, Origin{}.Resolve(req), "http://internal:8080")
+}
+
+func TestOriginXForwarded(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https, http")
+	req.Header.Set("X-Forwarded-Host", "example.com, internal")
+	test.AssertEqual(t, Origin{"", true}.Resolve(req), "https://example.com")
+}
+
+func TestOriginForwarded(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	req.Header.Set("Forwarded", `for=192.0.2.60;proto=https;host="example.com:8443", for=198.51.100.17`)
+	req.Header.Set("X-Forwarded-Host", "ignored.example.com")
+	test.AssertEqual(t, Origin{"", true}.Resolve(req), "https://example.com:8443")
+}
+
+func TestOriginInvalidForwardedHost(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	req.Header.Set("X-Forwarded-Proto", "javascript")
+	req.Header.Set("X-Forwarded-Host", "example.com>; rel=\"next\"")
+	test.AssertEqual(t, Origin{"", true}.Resolve(req), "http://internal:8080")
+}
+
+func TestParseOrigin(t *testing.T) {
+	origin, err := ParseOrigin("https://example.com/")
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, origin, "https://example.com")
+
+	for _, value := range []string{"example.com", "ftp://example.com", "https://example.com/app", "https://"} {
+		_, err = ParseOrigin(value)
+		test.AssertTrue(t, err != nil)
+	}
+}
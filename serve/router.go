@@ -0,0 +1,40 @@
+package serve
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// liveRouter dispatches requests to the most recently built route table.
+// Rebuilds happen off to the side and are swapped in atomically, so requests
+// already in flight finish against the table they started with.
+type liveRouter struct {
+	current atomic.Pointer[http.Handler]
+	build   func() http.Handler
+	mutex   sync.Mutex
+}
+
+func newLiveRouter(build func() http.Handler) *liveRouter {
+	router := &liveRouter{build: build}
+	handler := build()
+	router.current.Store(&handler)
+	return router
+}
+
+func (router *liveRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*router.current.Load()).ServeHTTP(w, r)
+}
+
+func (router *liveRouter) Rebuild() {
+	// Serialize rebuilds so an older walk can never replace a newer table.
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	start := time.Now()
+	handler := router.build()
+	router.current.Store(&handler)
+	slog.Debug(fmt.Sprintf("Rebuilt route table in %v", time.Since(start)))
+}
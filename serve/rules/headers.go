@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// HeaderRule is a path section of a Netlify/Cloudflare style _headers file, e.g.
+//
+//	/assets/i18n/*
+//	  Access-Control-Allow-Origin: *
+//	  ! X-Frame-Options
+type HeaderRule struct {
+	Path    string
+	Set     http.Header
+	Remove  []string
+	pattern *regexp.Regexp
+}
+
+type HeaderRules []HeaderRule
+
+// ReadHeadersFile parses the given _headers file. A missing file results
+// in no rules.
+func ReadHeadersFile(filePath string) (HeaderRules, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return HeaderRules{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	slog.Debug(fmt.Sprintf("Detected _headers file at %v. Reading rules.", filePath))
+	return ParseHeaders(f, filePath)
+}
+
+// ParseHeaders parses _headers rules. Unindented lines start a new path
+// section and indented lines either set (Name: value) or remove (! Name)
+// a header. Invalid lines are reported and skipped.
+func ParseHeaders(reader io.Reader, source string) (HeaderRules, error) {
+	rules := HeaderRules{}
+	var current *HeaderRule
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			pattern, err := compileSource(trimmed)
+			if err != nil || !strings.HasPrefix(trimmed, "/") {
+				slog.Warn(fmt.Sprintf("Skipping invalid path %v in %v:%v", trimmed, source, lineNumber))
+				current = nil
+				continue
+			}
+			rules = append(rules, HeaderRule{Path: trimmed, Set: make(http.Header), pattern: pattern})
+			current = &rules[len(rules)-1]
+		} else if current == nil {
+			slog.Warn(fmt.Sprintf("Skipping header without path in %v:%v", source, lineNumber))
+		} else if strings.HasPrefix(trimmed, "!") {
+			current.Remove = append(current.Remove, strings.TrimSpace(trimmed[1:]))
+		} else if name, value, ok := strings.Cut(trimmed, ":"); ok && len(strings.TrimSpace(name)) > 0 {
+			current.Set.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		} else {
+			slog.Warn(fmt.Sprintf("Skipping invalid header %v in %v:%v", trimmed, source, lineNumber))
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+// Apply modifies the given response headers with all rules matching the path.
+// Values of a header defined by multiple matching rules are combined and
+// replace the value set by the endpoint. Every value is sent as a separate
+// header line, as some headers (e.g. Set-Cookie) must not be folded.
+func (rules HeaderRules) Apply(path string, header http.Header) {
+	values := make(http.Header)
+	for _, rule := range rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		for name, ruleValues := range rule.Set {
+			values[name] = append(values[name], ruleValues...)
+		}
+		for _, name := range rule.Remove {
+			header.Del(name)
+			values.Del(name)
+		}
+	}
+
+	for name, headerValues := range values {
+		header[name] = headerValues
+	}
+}
+
+// Wrap returns a ResponseWriter, which applies the rules right before the
+// response header is written.
+func (rules HeaderRules) Wrap(w http.ResponseWriter, path string) http.ResponseWriter {
+	if len(rules) == 0 {
+		return w
+	}
+	return &headerRulesWriter{ResponseWriter: w, rules: rules, path: path}
+}
+
+type headerRulesWriter struct {
+	http.ResponseWriter
+	rules   HeaderRules
+	path    string
+	written bool
+}
+
+func (writer *headerRulesWriter) WriteHeader(code int) {
+	if !writer.written {
+		writer.written = true
+		writer.rules.Apply(writer.path, writer.Header())
+	}
+	writer.ResponseWriter.WriteHeader(code)
+}
+
+func (writer *headerRulesWriter) Write(content []byte) (int, error) {
+	if !writer.written {
+		writer.WriteHeader(http.StatusOK)
+	}
+	return writer.ResponseWriter.Write(content)
+}
+
+func (writer *headerRulesWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
@@ -0,0 +1,99 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"ngstaticserver/test"
+	"strings"
+	"testing"
+)
+
+const HeadersFile = `
+/*
+  X-Robots-Tag: noindex
+/assets/i18n/*
+  Access-Control-Allow-Origin: *
+  X-Robots-Tag: nofollow
+/assets/fonts/*
+  Cache-Control: max-age=31536000, immutable
+  ! X-Frame-Options
+  invalid
+  Orphan: header
+/*.woff2
+  Access-Control-Allow-Origin: https://example.com
+`
+
+func TestParseHeaders(t *testing.T) {
+	rules := parseTestHeaders(t)
+
+	test.AssertEqual(t, len(rules), 4)
+	test.AssertEqual(t, rules[0].Path, "/*")
+	test.AssertEqual(t, rules[1].Set.Get("Access-Control-Allow-Origin"), "*")
+	test.AssertEqual(t, rules[2].Set.Get("Cache-Control"), "max-age=31536000, immutable")
+	test.AssertEqual(t, rules[2].Remove[0], "X-Frame-Options")
+}
+
+func TestParseHeaders_headerWithoutPath(t *testing.T) {
+	rules, err := ParseHeaders(strings.NewReader("  X-Robots-Tag: noindex\n/*\n  X-Test: a"), "_headers")
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, len(rules), 1)
+	test.AssertEqual(t, len(rules[0].Set), 1)
+}
+
+func TestApplyHeaders(t *testing.T) {
+	rules := parseTestHeaders(t)
+
+	header := http.Header{}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Frame-Options", "DENY")
+	rules.Apply("/assets/fonts/roboto.woff2", header)
+	test.AssertEqual(t, header.Get("Cache-Control"), "max-age=31536000, immutable")
+	test.AssertEqual(t, header.Get("X-Frame-Options"), "")
+	test.AssertEqual(t, header.Get("X-Robots-Tag"), "noindex")
+	test.AssertEqual(t, header.Get("Access-Control-Allow-Origin"), "")
+
+	header = http.Header{}
+	rules.Apply("/roboto.woff2", header)
+	test.AssertEqual(t, header.Get("Access-Control-Allow-Origin"), "https://example.com")
+
+	header = http.Header{}
+	rules.Apply("/assets/i18n/de.json", header)
+	test.AssertEqual(t, header.Get("Access-Control-Allow-Origin"), "*")
+	test.AssertEqual(t, strings.Join(header.Values("X-Robots-Tag"), "|"), "noindex|nofollow")
+
+	header = http.Header{}
+	header.Set("Cache-Control", "no-cache")
+	rules.Apply("/main.js", header)
+	test.AssertEqual(t, header.Get("Cache-Control"), "no-cache")
+	test.AssertEqual(t, header.Get("Access-Control-Allow-Origin"), "")
+}
+
+func TestApplyHeaders_setCookie(t *testing.T) {
+	rules, err := ParseHeaders(strings.NewReader("/*\n  Set-Cookie: a=1; Path=/\n  Set-Cookie: b=2; Path=/"), "_headers")
+	test.AssertNoError(t, err)
+
+	header := http.Header{}
+	header.Set("Set-Cookie", "ngss_lang=de; Path=/")
+	rules.Apply("/", header)
+	test.AssertEqual(t, len(header.Values("Set-Cookie")), 2)
+	test.AssertEqual(t, header.Values("Set-Cookie")[0], "a=1; Path=/")
+	test.AssertEqual(t, header.Values("Set-Cookie")[1], "b=2; Path=/")
+}
+
+func TestWrap(t *testing.T) {
+	rules := parseTestHeaders(t)
+	recorder := httptest.NewRecorder()
+	w := rules.Wrap(recorder, "/assets/fonts/roboto.woff2")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte("font"))
+
+	test.AssertEqual(t, recorder.Result().Header.Get("Cache-Control"), "max-age=31536000, immutable")
+	test.AssertEqual(t, recorder.Body.String(), "font")
+}
+
+func parseTestHeaders(t *testing.T) HeaderRules {
+	t.Helper()
+	rules, err := ParseHeaders(strings.NewReader(HeadersFile), "_headers")
+	test.AssertNoError(t, err)
+	return rules
+}
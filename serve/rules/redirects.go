@@ -0,0 +1,244 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Redirect is a single rule of a Netlify style _redirects file, e.g.
+//
+//	/blog/:slug  /news/:slug  301
+//	/store id=:id  /products/:id  302
+//	/app/*  /index.html  200
+type Redirect struct {
+	From   string
+	To     string
+	Status int
+	// Force applies the rule even if a file exists for the requested path.
+	Force bool
+	// Query contains the query parameters which must be present, mapped
+	// to either a fixed value or a :placeholder.
+	Query   map[string]string
+	pattern *regexp.Regexp
+}
+
+type Redirects []Redirect
+
+var placeholderRegex = regexp.MustCompile(`:([A-Za-z_][A-Za-z0-9_]*)`)
+
+// ReadRedirectsFile parses the given _redirects file. A missing file results
+// in no rules.
+func ReadRedirectsFile(filePath string) (Redirects, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return Redirects{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	slog.Debug(fmt.Sprintf("Detected _redirects file at %v. Reading rules.", filePath))
+	return ParseRedirects(f, filePath)
+}
+
+// ParseRedirects parses _redirects rules. Invalid lines are reported and
+// skipped, so one broken rule does not disable the others.
+func ParseRedirects(reader io.Reader, source string) (Redirects, error) {
+	redirects := Redirects{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		redirect, err := parseRedirect(strings.Fields(line))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Skipping invalid rule in %v:%v (%v)", source, lineNumber, err))
+			continue
+		}
+		redirects = append(redirects, redirect)
+	}
+
+	return redirects, scanner.Err()
+}
+
+func parseRedirect(fields []string) (Redirect, error) {
+	if len(fields) < 2 {
+		return Redirect{}, fmt.Errorf("expected at least a source and a target")
+	} else if !strings.HasPrefix(fields[0], "/") {
+		return Redirect{}, fmt.Errorf("source %v must start with /", fields[0])
+	}
+
+	redirect := Redirect{From: fields[0], Status: http.StatusMovedPermanently, Query: make(map[string]string)}
+	rest := fields[1:]
+	for len(rest) > 0 && !isTarget(rest[0]) {
+		key, value, ok := strings.Cut(rest[0], "=")
+		if !ok {
+			return Redirect{}, fmt.Errorf("expected query parameter condition key=value, got %v", rest[0])
+		}
+		redirect.Query[key] = value
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return Redirect{}, fmt.Errorf("missing target")
+	}
+	redirect.To = rest[0]
+
+	if len(rest) > 1 {
+		status := rest[1]
+		if strings.HasSuffix(status, "!") {
+			redirect.Force = true
+			status = strings.TrimSuffix(status, "!")
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return Redirect{}, fmt.Errorf("invalid status %v", rest[1])
+		}
+		redirect.Status = code
+	}
+
+	switch redirect.Status {
+	case http.StatusOK:
+		if !strings.HasPrefix(redirect.To, "/") {
+			return Redirect{}, fmt.Errorf("rewrites (200) only support local targets, got %v", redirect.To)
+		}
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return Redirect{}, fmt.Errorf("unsupported status %v (must be 200, 301, 302, 307 or 308)", redirect.Status)
+	}
+
+	pattern, err := compileSource(redirect.From)
+	if err != nil {
+		return Redirect{}, err
+	}
+	redirect.pattern = pattern
+	return redirect, nil
+}
+
+func isTarget(field string) bool {
+	return strings.HasPrefix(field, "/") || strings.Contains(field, "://")
+}
+
+// compileSource converts the source path of a rule into a regular expression,
+// where :name matches a single path segment and a * segment matches the rest
+// of the path (available as :splat). A * within a segment (e.g. *.woff2)
+// matches within that segment.
+func compileSource(source string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for _, segment := range strings.Split(strings.Trim(source, "/"), "/") {
+		if segment == "*" {
+			builder.WriteString("(?:/(?P<splat>.*))?")
+		} else if strings.HasPrefix(segment, ":") {
+			builder.WriteString(fmt.Sprintf("/(?P<%v>[^/]+)", segment[1:]))
+		} else if len(segment) > 0 {
+			parts := strings.Split(segment, "*")
+			for i := range parts {
+				parts[i] = regexp.QuoteMeta(parts[i])
+			}
+			builder.WriteString("/" + strings.Join(parts, "[^/]*"))
+		}
+	}
+	builder.WriteString("/?$")
+	pattern, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid source %v", source)
+	}
+	return pattern, nil
+}
+
+// Resolve returns the target of the rule for the given request, if it matches.
+func (redirect Redirect) Resolve(r *http.Request) (string, bool) {
+	match := redirect.pattern.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		return "", false
+	}
+
+	values := make(map[string]string)
+	for i, name := range redirect.pattern.SubexpNames() {
+		if len(name) > 0 {
+			values[name] = match[i]
+		}
+	}
+	query := r.URL.Query()
+	for key, expected := range redirect.Query {
+		if !query.Has(key) {
+			return "", false
+		} else if strings.HasPrefix(expected, ":") {
+			values[expected[1:]] = query.Get(key)
+		} else if query.Get(key) != expected {
+			return "", false
+		}
+	}
+
+	target := placeholderRegex.ReplaceAllStringFunc(redirect.To, func(placeholder string) string {
+		if value, ok := values[placeholder[1:]]; ok {
+			return value
+		}
+		return placeholder
+	})
+	if len(redirect.Query) == 0 && len(r.URL.RawQuery) > 0 && !strings.Contains(target, "?") {
+		target += "?" + r.URL.RawQuery
+	}
+
+	return target, true
+}
+
+// RedirectHandler applies the redirect and rewrite rules before handing the
+// request to the route table. Rules are shadowed by existing files, unless
+// they are forced with !.
+type RedirectHandler struct {
+	Redirects Redirects
+	Next      http.Handler
+	Exists    func(path string) bool
+}
+
+func (handler RedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	exists := handler.Exists(r.URL.Path)
+	for _, redirect := range handler.Redirects {
+		if exists && !redirect.Force {
+			continue
+		}
+		target, ok := redirect.Resolve(r)
+		if !ok {
+			continue
+		}
+
+		if redirect.Status == http.StatusOK {
+			handler.rewrite(w, r, target)
+		} else {
+			slog.Debug(fmt.Sprintf("Redirecting %v to %v", r.URL.Path, target), "status", redirect.Status)
+			http.Redirect(w, r, target, redirect.Status)
+		}
+		return
+	}
+
+	handler.Next.ServeHTTP(w, r)
+}
+
+func (handler RedirectHandler) rewrite(w http.ResponseWriter, r *http.Request, target string) {
+	targetUrl, err := url.Parse(target)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Debug(fmt.Sprintf("Rewriting %v to %v", r.URL.Path, targetUrl.Path))
+	rewritten := r.Clone(r.Context())
+	rewritten.URL.Path = targetUrl.Path
+	rewritten.URL.RawPath = ""
+	rewritten.URL.RawQuery = targetUrl.RawQuery
+	rewritten.RequestURI = targetUrl.RequestURI()
+	handler.Next.ServeHTTP(w, rewritten)
+}
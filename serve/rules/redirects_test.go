@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"ngstaticserver/test"
+	"strings"
+	"testing"
+)
+
+const RedirectsFile = `
+# Permanent moves
+/old-path            /new-path            301
+/blog/:slug          /news/:slug
+/news/*              /articles/:splat     302
+/store id=:id        /products/:id        307
+/legacy type=pdf     /documents           308
+/app/*               /index.html          200
+/forced              /elsewhere           301!
+/invalid
+/unsupported         /somewhere           418
+`
+
+func TestParseRedirects(t *testing.T) {
+	redirects := parseTestRedirects(t)
+
+	test.AssertEqual(t, len(redirects), 7)
+	test.AssertEqual(t, redirects[0].From, "/old-path")
+	test.AssertEqual(t, redirects[0].To, "/new-path")
+	test.AssertEqual(t, redirects[0].Status, 301)
+	test.AssertEqual(t, redirects[1].Status, 301)
+	test.AssertEqual(t, redirects[3].Query["id"], ":id")
+	test.AssertEqual(t, redirects[5].Status, 200)
+	test.AssertTrue(t, !redirects[5].Force)
+	test.AssertTrue(t, redirects[6].Force)
+}
+
+func TestResolveRedirects(t *testing.T) {
+	redirects := parseTestRedirects(t)
+
+	for path, expected := range map[string]string{
+		"/old-path":         "/new-path",
+		"/old-path/":        "/new-path",
+		"/old-path?a=b":     "/new-path?a=b",
+		"/blog/hello-world": "/news/hello-world",
+		"/news":             "/articles/",
+		"/news/2023/10/a":   "/articles/2023/10/a",
+		"/store?id=42":      "/products/42",
+		"/legacy?type=pdf":  "/documents",
+		"/app/settings":     "/index.html",
+	} {
+		target, ok := resolve(redirects, path)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, target, expected)
+	}
+
+	for _, path := range []string{"/newsletter", "/blog/a/b", "/store", "/legacy?type=doc", "/other"} {
+		_, ok := resolve(redirects, path)
+		test.AssertTrue(t, !ok)
+	}
+}
+
+func TestResolveRedirects_wildcardInSegment(t *testing.T) {
+	redirects, err := ParseRedirects(strings.NewReader("/fonts/*.woff /fonts/fallback.woff2 301\n/v*/docs /docs 302"), "_redirects")
+	test.AssertNoError(t, err)
+
+	for path, expected := range map[string]string{
+		"/fonts/roboto.woff": "/fonts/fallback.woff2",
+		"/fonts/.woff":       "/fonts/fallback.woff2",
+		"/v2/docs":           "/docs",
+	} {
+		target, ok := resolve(redirects, path)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, target, expected)
+	}
+
+	// A * within a segment does not match across segments
+	for _, path := range []string{"/fonts/a/b.woff", "/fonts/roboto.woff2", "/v2/beta/docs", "/fonts"} {
+		_, ok := resolve(redirects, path)
+		test.AssertTrue(t, !ok)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	redirects := parseTestRedirects(t)
+	var nextPath string
+	handler := RedirectHandler{
+		Redirects: redirects,
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nextPath = r.URL.Path
+		}),
+		Exists: func(path string) bool {
+			return path == "/old-path" || path == "/forced"
+		},
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/blog/hello", nil))
+	test.AssertEqual(t, w.Result().StatusCode, 301)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/news/hello")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/app/settings", nil))
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+	test.AssertEqual(t, nextPath, "/index.html")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/old-path", nil))
+	test.AssertEqual(t, nextPath, "/old-path")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/forced", nil))
+	test.AssertEqual(t, w.Result().StatusCode, 301)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/elsewhere")
+}
+
+func TestReadRedirectsFile_missing(t *testing.T) {
+	context := test.NewTestDir(t)
+	redirects, err := ReadRedirectsFile(context.Join("_redirects"))
+	test.AssertNoError(t, err)
+	test.AssertEqual(t, len(redirects), 0)
+}
+
+func parseTestRedirects(t *testing.T) Redirects {
+	t.Helper()
+	redirects, err := ParseRedirects(strings.NewReader(RedirectsFile), "_redirects")
+	test.AssertNoError(t, err)
+	return redirects
+}
+
+func resolve(redirects Redirects, path string) (string, bool) {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, redirect := range redirects {
+		if target, ok := redirect.Resolve(req); ok {
+			return target, true
+		}
+	}
+	return "", false
+}
@@ -1,19 +1,33 @@
 package serve
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"ngstaticserver/constants"
+	"ngstaticserver/serve/cache"
 	"ngstaticserver/serve/config"
 	"ngstaticserver/serve/endpoints"
+	"ngstaticserver/serve/headers"
+	"ngstaticserver/serve/rules"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/dimfeld/httptreemux/v5"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var Flags = []cli.Flag{
@@ -33,6 +47,21 @@ var Flags = []cli.Flag{
 		Name:    "compression-threshold",
 		Value:   constants.DefaultCompressionThreshold,
 	},
+	&cli.StringSliceFlag{
+		EnvVars: []string{"_ENCODING_PREFERENCE"},
+		Name:    "encoding-preference",
+		Value:   cli.NewStringSlice("zstd", "br", "gzip"),
+	},
+	&cli.Int64Flag{
+		EnvVars: []string{"_CACHE_SIZE"},
+		Name:    "cache-size",
+		Value:   constants.DefaultCacheSize,
+	},
+	&cli.Int64Flag{
+		EnvVars: []string{"_CACHE_MAX_FILE_SIZE"},
+		Name:    "cache-max-file-size",
+		Value:   constants.DefaultCacheMaxFileSize,
+	},
 	&cli.StringFlag{
 		EnvVars: []string{"_LOG_LEVEL"},
 		Name:    "log-level",
@@ -49,6 +78,72 @@ var Flags = []cli.Flag{
 		Name:    "i18n-default",
 		Value:   "",
 	},
+	&cli.StringSliceFlag{
+		EnvVars: []string{"_I18N_LOCALES"},
+		Name:    "i18n-locales",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_I18N_DEFAULT_PREFIX"},
+		Name:    "i18n-default-prefix",
+		Value:   endpoints.I18nPrefixAlways,
+	},
+	&cli.StringSliceFlag{
+		EnvVars: []string{"_I18N_HOST_MAP"},
+		Name:    "i18n-host-map",
+	},
+	&cli.BoolFlag{
+		EnvVars: []string{"_I18N_HOST_REDIRECT"},
+		Name:    "i18n-host-redirect",
+		Value:   false,
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_CANONICAL_ORIGIN"},
+		Name:    "canonical-origin",
+		Value:   "",
+	},
+	&cli.BoolFlag{
+		EnvVars: []string{"_TRUST_FORWARDED_HEADERS"},
+		Name:    "trust-forwarded-headers",
+		Value:   false,
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_FALLBACK"},
+		Name:    "fallback",
+		Value:   endpoints.FallbackAuto,
+	},
+	&cli.StringSliceFlag{
+		EnvVars: []string{"_FALLBACK_EXCLUDE"},
+		Name:    "fallback-exclude",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_REDIRECTS_FILE"},
+		Name:    "redirects-file",
+		Value:   "",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_HEADERS_FILE"},
+		Name:    "headers-file",
+		Value:   "",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_PUBLIC_ENV_PREFIX"},
+		Name:    "public-env-prefix",
+		Value:   "",
+	},
+	&cli.StringSliceFlag{
+		EnvVars: []string{"_PUBLIC_ENV"},
+		Name:    "public-env",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_APP_ENV"},
+		Name:    "app-env",
+		Value:   "",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_CONFIG_DIR"},
+		Name:    "config-dir",
+		Value:   "",
+	},
 	&cli.StringFlag{
 		EnvVars: []string{"_CSP_TEMPLATE"},
 		Name:    "csp-template",
@@ -89,6 +184,51 @@ var Flags = []cli.Flag{
 		Name:    "x-frame-options",
 		Value:   "DENY",
 	},
+	&cli.StringFlag{
+		EnvVars: []string{"_TLS_CERT"},
+		Name:    "tls-cert",
+		Value:   "",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_TLS_KEY"},
+		Name:    "tls-key",
+		Value:   "",
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_TLS_CLIENT_CA"},
+		Name:    "tls-client-ca",
+		Value:   "",
+	},
+	&cli.BoolFlag{
+		EnvVars: []string{"_H2C"},
+		Name:    "h2c",
+		Value:   false,
+	},
+	&cli.DurationFlag{
+		EnvVars: []string{"_SHUTDOWN_DELAY"},
+		Name:    "shutdown-delay",
+		Value:   0,
+	},
+	&cli.DurationFlag{
+		EnvVars: []string{"_SHUTDOWN_TIMEOUT"},
+		Name:    "shutdown-timeout",
+		Value:   constants.DefaultShutdownTimeout,
+	},
+	&cli.DurationFlag{
+		EnvVars: []string{"_WATCH_DEBOUNCE"},
+		Name:    "watch-debounce",
+		Value:   constants.DefaultWatchDebounce,
+	},
+	&cli.StringFlag{
+		EnvVars: []string{"_WATCH_MODE"},
+		Name:    "watch-mode",
+		Value:   config.WatchModeAuto,
+	},
+	&cli.DurationFlag{
+		EnvVars: []string{"_WATCH_INTERVAL"},
+		Name:    "watch-interval",
+		Value:   constants.DefaultWatchInterval,
+	},
 }
 
 type ServerParams struct {
@@ -96,18 +236,49 @@ type ServerParams struct {
 	Port                 int
 	CacheControlMaxAge   int64
 	CompressionThreshold int64
+	EncodingPreference   []headers.Encoding
+	CacheSize            int64
+	CacheMaxFileSize     int64
 	I18nDefault          string
+	I18nLocales          []string
+	I18nDefaultPrefix    string
+	I18nHostMap          []endpoints.HostLocale
+	I18nHostRedirect     bool
+	CanonicalOrigin      string
+	TrustForwarded       bool
+	Fallback             endpoints.FallbackPolicy
+	RedirectsFile        string
+	HeadersFile          string
+	PublicVariables      config.PublicVariables
+	AppEnv               string
+	ConfigDir            string
 	LogLevel             string
 	LogFormat            string
 	CspTemplate          string
 	XFrameOptions        string
+	TlsCert              string
+	TlsKey               string
+	TlsClientCa          string
+	H2c                  bool
+	ShutdownDelay        time.Duration
+	ShutdownTimeout      time.Duration
+	WatchDebounce        time.Duration
+	Watch                config.WatchOptions
 }
 
 type App struct {
-	params       *ServerParams
-	appVariables *config.AppVariables
-	env          *config.DotEnv
-	fileWatcher  *config.FileWatcher
+	params *ServerParams
+	// variables contains the app variables of the .env file, the ngssc.json
+	// files and the locales.
+	variables   *variableSet
+	env         *config.LayeredDotEnv
+	fileWatcher *config.FileWatcher
+	treeWatcher *config.TreeWatcher
+	assetCache  *cache.AssetCache
+	draining    *atomic.Bool
+	// h2cConnections tracks the hijacked h2c connections, which are not
+	// drained by http.Server.Shutdown.
+	h2cConnections *sync.WaitGroup
 }
 
 func Action(c *cli.Context) error {
@@ -122,22 +293,73 @@ func Action(c *cli.Context) error {
 	Port:                 %v
 	CacheControlMaxAge:   %v
 	CompressionThreshold: %v
+	EncodingPreference:   %v
+	CacheSize:            %v
+	CacheMaxFileSize:     %v
 	I18nDefault:          %v
+	I18nLocales:          %v
+	I18nDefaultPrefix:    %v
+	I18nHostMap:          %v
+	I18nHostRedirect:     %v
+	CanonicalOrigin:      %v
+	TrustForwarded:       %v
+	Fallback:             %v %v
+	RedirectsFile:        %v
+	HeadersFile:          %v
+	PublicEnvPrefix:      %v
+	PublicEnv:            %v
+	AppEnv:               %v
+	ConfigDir:            %v
 	LogLevel:             %v
 	LogFormat:            %v
 	CspTemplate:          %v
 	XFrameOptions:        %v
+	TlsCert:              %v
+	TlsKey:               %v
+	TlsClientCa:          %v
+	H2c:                  %v
+	ShutdownDelay:        %v
+	ShutdownTimeout:      %v
+	WatchDebounce:        %v
+	WatchMode:            %v
+	WatchInterval:        %v
 
 `,
 		params.WorkingDirectory,
 		params.Port,
 		params.CacheControlMaxAge,
 		params.CompressionThreshold,
+		strings.Join(c.StringSlice("encoding-preference"), ","),
+		params.CacheSize,
+		params.CacheMaxFileSize,
 		params.I18nDefault,
+		strings.Join(params.I18nLocales, ","),
+		params.I18nDefaultPrefix,
+		strings.Join(c.StringSlice("i18n-host-map"), ","),
+		params.I18nHostRedirect,
+		params.CanonicalOrigin,
+		params.TrustForwarded,
+		params.Fallback.Mode,
+		c.StringSlice("fallback-exclude"),
+		params.RedirectsFile,
+		params.HeadersFile,
+		params.PublicVariables.Prefix,
+		strings.Join(params.PublicVariables.Names, ","),
+		params.AppEnv,
+		params.ConfigDir,
 		params.LogLevel,
 		params.LogFormat,
 		params.CspTemplate,
 		params.XFrameOptions,
+		params.TlsCert,
+		params.TlsKey,
+		params.TlsClientCa,
+		params.H2c,
+		params.ShutdownDelay,
+		params.ShutdownTimeout,
+		params.WatchDebounce,
+		params.Watch.Mode,
+		params.Watch.Interval,
 	)
 
 	// Configure slog logger
@@ -157,12 +379,46 @@ func Action(c *cli.Context) error {
 	}
 
 	slog.Debug("HTTP server setup start")
-	app := createApp(params)
+	app, err := createApp(params)
+	if err != nil {
+		return err
+	}
 	defer app.Close()
+	_, err = app.resolveLocales()
+	if err != nil {
+		return err
+	}
 
-	router := app.createRouter()
+	router := app.createLiveRouter()
+	server, err := app.createServer(router)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
 	slog.Debug("HTTP server setup complete")
-	return http.ListenAndServe(fmt.Sprintf(":%v", params.Port), router)
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serveHTTP(server, listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+		stop()
+		app.shutdown(server)
+		// Serve returns http.ErrServerClosed once the server is shut down.
+		if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
 }
 
 func parseServerParams(c *cli.Context) (*ServerParams, error) {
@@ -190,27 +446,260 @@ func parseServerParams(c *cli.Context) (*ServerParams, error) {
 		cspTemplate = strings.ReplaceAll(cspTemplate, "${_CSP_STYLE_SRC}", c.String("csp-style-src"))
 	}
 
+	if (len(c.String("tls-cert")) > 0) != (len(c.String("tls-key")) > 0) {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be used together")
+	} else if len(c.String("tls-client-ca")) > 0 && len(c.String("tls-cert")) == 0 {
+		return nil, fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+	} else if c.Bool("h2c") && len(c.String("tls-cert")) > 0 {
+		return nil, fmt.Errorf("--h2c cannot be used with --tls-cert, as HTTP/2 is negotiated via TLS")
+	}
+
+	redirectsFile, err := resolveRulesFile(workingDirectory, c.String("redirects-file"), "_redirects")
+	if err != nil {
+		return nil, err
+	}
+	headersFile, err := resolveRulesFile(workingDirectory, c.String("headers-file"), "_headers")
+	if err != nil {
+		return nil, err
+	}
+
+	encodingPreference, err := headers.ParsePreference(c.StringSlice("encoding-preference"))
+	if err != nil {
+		return nil, err
+	}
+
+	i18nDefaultPrefix := c.String("i18n-default-prefix")
+	switch i18nDefaultPrefix {
+	case endpoints.I18nPrefixAlways, endpoints.I18nPrefixOptional, endpoints.I18nPrefixNever:
+	default:
+		return nil, fmt.Errorf("--i18n-default-prefix must be %v, %v or %v, got %v",
+			endpoints.I18nPrefixAlways, endpoints.I18nPrefixOptional, endpoints.I18nPrefixNever, i18nDefaultPrefix)
+	}
+
+	i18nHostMap, err := endpoints.ParseHostLocales(c.StringSlice("i18n-host-map"))
+	if err != nil {
+		return nil, err
+	}
+
+	canonicalOrigin, err := headers.ParseOrigin(c.String("canonical-origin"))
+	if err != nil {
+		return nil, fmt.Errorf("--canonical-origin: %v", err)
+	}
+
+	fallback, err := endpoints.ParseFallbackPolicy(c.String("fallback"), c.StringSlice("fallback-exclude"))
+	if err != nil {
+		return nil, err
+	}
+
+	configDir := c.String("config-dir")
+	if len(configDir) > 0 {
+		configDir, err = filepath.Abs(configDir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve the absolute path of %v\n%v", c.String("config-dir"), err)
+		} else if info, err := os.Stat(configDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("--config-dir must be an existing directory, got %v", configDir)
+		}
+	}
+
+	watchMode, err := config.ParseWatchMode(c.String("watch-mode"))
+	if err != nil {
+		return nil, err
+	} else if c.Duration("watch-interval") <= 0 {
+		return nil, fmt.Errorf("--watch-interval must be positive, got %v", c.Duration("watch-interval"))
+	}
+
+	publicEnv := make([]string, 0)
+	for _, name := range c.StringSlice("public-env") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			publicEnv = append(publicEnv, name)
+		}
+	}
+
 	params := &ServerParams{
 		WorkingDirectory:     workingDirectory,
 		Port:                 c.Int("port"),
 		CacheControlMaxAge:   c.Int64("cache-control-max-age"),
 		CompressionThreshold: c.Int64("compression-threshold"),
+		EncodingPreference:   encodingPreference,
+		CacheSize:            c.Int64("cache-size"),
+		CacheMaxFileSize:     c.Int64("cache-max-file-size"),
 		I18nDefault:          c.String("i18n-default"),
+		I18nLocales:          c.StringSlice("i18n-locales"),
+		I18nDefaultPrefix:    i18nDefaultPrefix,
+		I18nHostMap:          i18nHostMap,
+		I18nHostRedirect:     c.Bool("i18n-host-redirect"),
+		CanonicalOrigin:      canonicalOrigin,
+		TrustForwarded:       c.Bool("trust-forwarded-headers"),
+		Fallback:             fallback,
+		RedirectsFile:        redirectsFile,
+		HeadersFile:          headersFile,
+		PublicVariables:      config.PublicVariables{Prefix: c.String("public-env-prefix"), Names: publicEnv},
+		AppEnv:               c.String("app-env"),
+		ConfigDir:            configDir,
 		LogLevel:             c.String("log-level"),
 		LogFormat:            c.String("log-format"),
 		CspTemplate:          cspTemplate,
 		XFrameOptions:        c.String("x-frame-options"),
+		TlsCert:              c.String("tls-cert"),
+		TlsKey:               c.String("tls-key"),
+		TlsClientCa:          c.String("tls-client-ca"),
+		H2c:                  c.Bool("h2c"),
+		ShutdownDelay:        c.Duration("shutdown-delay"),
+		ShutdownTimeout:      c.Duration("shutdown-timeout"),
+		WatchDebounce:        c.Duration("watch-debounce"),
+		Watch:                config.WatchOptions{Mode: watchMode, Interval: c.Duration("watch-interval")},
 	}
 
 	return params, nil
 }
 
-func createApp(params *ServerParams) App {
-	fileWatcher := config.CreateFileWatcher()
-	appVariables := config.InitializeAppVariables(params.WorkingDirectory)
-	dotEnv := config.CreateDotEnv(params.WorkingDirectory, appVariables.MergeVariables)
-	fileWatcher.Watch(dotEnv)
-	return App{params, appVariables, dotEnv, fileWatcher}
+func resolveRulesFile(workingDirectory, filePath, defaultName string) (string, error) {
+	if len(filePath) == 0 {
+		return filepath.Join(workingDirectory, defaultName), nil
+	}
+
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve the absolute path of %v\n%v", filePath, err)
+	}
+	return absolutePath, nil
+}
+
+func createApp(params *ServerParams) (App, error) {
+	fileWatcher, err := config.CreateFileWatcher(params.Watch)
+	if err != nil {
+		return App{}, err
+	}
+	assetCache := cache.NewAssetCache(params.CacheSize, params.CacheMaxFileSize)
+	app := App{params, nil, nil, fileWatcher, nil, assetCache, &atomic.Bool{}, &sync.WaitGroup{}}
+
+	// Errors are reported when starting the server.
+	locales, _ := app.resolveLocales()
+	app.variables, err = newVariableSet(params, locales)
+	if err != nil {
+		fileWatcher.Close()
+		return App{}, err
+	}
+	// The config directory often contains secrets (e.g. /run/secrets), so
+	// its variables must be selected by an ngssc.json or a public policy.
+	if len(params.ConfigDir) > 0 && !app.variables.hasNgssc() && !params.PublicVariables.IsDefined() {
+		fileWatcher.Close()
+		return App{}, fmt.Errorf("--config-dir requires an ngssc.json or --public-env-prefix or --public-env")
+	}
+	// Variables of the config directory override the variables of the .env files.
+	sources := config.NewVariableSources(2, app.variables.mergeGlobal)
+	app.env = config.CreateLayeredDotEnv(params.WorkingDirectory, params.AppEnv, sources.Source(0))
+	if len(params.ConfigDir) > 0 {
+		err = fileWatcher.Watch(config.CreateConfigDir(params.ConfigDir, sources.Source(1)))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Failed to watch %v. Variables will not be updated.", params.ConfigDir), "error", err)
+		}
+	}
+	for _, watchable := range app.env.Watchables() {
+		fileWatcher.Watch(watchable)
+	}
+	for _, localeVariables := range app.variables.locales {
+		fileWatcher.Watch(config.CreateLocaleDotEnv(params.WorkingDirectory, localeVariables.Locale, localeVariables.MergeOverlay))
+	}
+	if skipped := app.variables.skippedVariables(); !app.variables.hasNgssc() && len(skipped) > 0 {
+		if params.PublicVariables.IsDefined() {
+			slog.Warn(fmt.Sprintf("Skipping variables %v, which are not public (see --public-env-prefix and --public-env).",
+				strings.Join(skipped, ", ")))
+		} else {
+			slog.Warn(fmt.Sprintf("Skipping variables %v, as no variables are public. "+
+				"Use --public-env-prefix or --public-env to expose variables to the browser.", strings.Join(skipped, ", ")))
+		}
+	}
+	return app, nil
+}
+
+// createServer configures TLS with certificate reloading, if a certificate
+// is configured, or cleartext HTTP/2 (h2c) on the plain port, if enabled.
+func (app *App) createServer(handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%v", app.params.Port),
+		Handler: handler,
+	}
+	if len(app.params.TlsCert) > 0 {
+		certificate, err := config.LoadCertificate(app.params.TlsCert, app.params.TlsKey, app.params.TlsClientCa)
+		if err != nil {
+			return nil, err
+		}
+		for _, watchable := range certificate.Watchables() {
+			err = app.fileWatcher.Watch(watchable)
+			if err != nil {
+				slog.Warn("Failed to watch TLS certificate. Certificate will not be reloaded.", "error", err)
+			}
+		}
+		server.TLSConfig = certificate.TLSConfig()
+	} else if app.params.H2c {
+		// The HTTP/2 server is registered for the shutdown of the server, so
+		// that the h2c connections are sent a GOAWAY and finish their streams.
+		h2s := &http2.Server{}
+		err := http2.ConfigureServer(server, h2s)
+		if err != nil {
+			return nil, err
+		}
+		// ConfigureServer prepares a TLS configuration, which would make
+		// serveHTTP serve TLS.
+		server.TLSConfig = nil
+		h2cHandler := h2c.NewHandler(handler, h2s)
+		server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.h2cConnections.Add(1)
+			defer app.h2cConnections.Done()
+			h2cHandler.ServeHTTP(w, r)
+		})
+	}
+
+	return server, nil
+}
+
+func serveHTTP(server *http.Server, listener net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(listener, "", "")
+	}
+	return server.Serve(listener)
+}
+
+// shutdown first reports the server as not ready, waits for load balancers
+// to stop routing traffic to it and then drains open connections.
+func (app *App) shutdown(server *http.Server) {
+	slog.Info("Shutdown requested. Reporting not ready on /__lbheartbeat__.")
+	app.draining.Store(true)
+	if app.params.ShutdownDelay > 0 {
+		slog.Info(fmt.Sprintf("Waiting %v before draining connections.", app.params.ShutdownDelay))
+		time.Sleep(app.params.ShutdownDelay)
+	}
+
+	slog.Info(fmt.Sprintf("Draining connections (timeout %v).", app.params.ShutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), app.params.ShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err == nil {
+		err = app.awaitH2cConnections(ctx)
+	}
+	if err != nil {
+		slog.Warn("Failed to drain connections in time. Closing remaining connections.", "error", err)
+		server.Close()
+	}
+
+	slog.Info("Shutdown complete.")
+}
+
+// awaitH2cConnections waits until the h2c connections finished their
+// streams. It must only be called after the server has been shut down.
+func (app *App) awaitH2cConnections(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.h2cConnections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 type loggingResponseWriter struct {
@@ -223,48 +712,214 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-func (app App) createRouter() *httptreemux.TreeMux {
+// createLiveRouter builds the route table and rebuilds it whenever
+// files in the working directory are added, changed or removed.
+func (app *App) createLiveRouter() *liveRouter {
+	router := newLiveRouter(app.createRouter)
+
+	// Changed ngssc.json files are read again before rebuilding the routes,
+	// which also recomputes the CSP hashes of the index.html files. The
+	// ngssc.json files found by a reload are watched as well.
+	var watchMutex sync.Mutex
+	watched := make(map[string]bool)
+	var reload func() bool
+	watchNgsscFiles := func() {
+		watchMutex.Lock()
+		defer watchMutex.Unlock()
+		for _, ngsscFile := range app.variables.ngsscFiles() {
+			if watched[ngsscFile] {
+				continue
+			}
+			watched[ngsscFile] = true
+			err := app.fileWatcher.Watch(config.CallbackFile(ngsscFile, func() {
+				slog.Info(fmt.Sprintf("Detected change in %v. Reloading configuration.", ngsscFile))
+				if reload() {
+					router.Rebuild()
+				}
+			}))
+			if err != nil {
+				slog.Warn(fmt.Sprintf("Failed to watch %v. Configuration will not be updated.", ngsscFile), "error", err)
+			}
+		}
+	}
+	reload = func() bool {
+		if err := app.variables.reload(); err != nil {
+			slog.Error("Failed to reload ngssc.json. Continuing with previous configuration.", "error", err)
+			return false
+		}
+		watchNgsscFiles()
+		return true
+	}
+	watchNgsscFiles()
+
+	treeWatcher, err := config.CreateTreeWatcher(app.params.WorkingDirectory, app.params.WatchDebounce, app.params.Watch, func() {
+		slog.Info(fmt.Sprintf("Detected changes in %v. Rebuilding routes.", app.params.WorkingDirectory))
+		// Changes of known ngssc.json files are handled by their watches.
+		if app.variables.ngsscAddedOrRemoved() {
+			slog.Info("Detected added or removed ngssc.json files. Reloading configuration.")
+			reload()
+		}
+		router.Rebuild()
+	})
+	if err != nil {
+		slog.Warn("Failed to watch working directory. Routes will not be updated.", "error", err)
+	} else {
+		app.treeWatcher = treeWatcher
+	}
+
+	// Changes in the working directory are picked up by the tree watcher.
+	for _, rulesFile := range []string{app.redirectsFile(), app.headersFile()} {
+		if relative, err := filepath.Rel(app.params.WorkingDirectory, rulesFile); err == nil && !strings.HasPrefix(relative, "..") {
+			continue
+		}
+		err = app.fileWatcher.Watch(config.CallbackFile(rulesFile, router.Rebuild))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Failed to watch %v. Rules will not be updated.", rulesFile), "error", err)
+		}
+	}
+
+	return router
+}
+
+// resolveLocales returns the locales of an i18n build, which is an app
+// without an index.html in the working directory.
+func (app App) resolveLocales() ([]string, error) {
+	info, err := os.Stat(filepath.Join(app.params.WorkingDirectory, "index.html"))
+	if err == nil && !info.IsDir() {
+		return nil, nil
+	}
+
+	return endpoints.ResolveLocales(app.params.WorkingDirectory, app.params.I18nLocales)
+}
+
+func (app App) redirectsFile() string {
+	if len(app.params.RedirectsFile) > 0 {
+		return app.params.RedirectsFile
+	}
+	return filepath.Join(app.params.WorkingDirectory, "_redirects")
+}
+
+func (app App) headersFile() string {
+	if len(app.params.HeadersFile) > 0 {
+		return app.params.HeadersFile
+	}
+	return filepath.Join(app.params.WorkingDirectory, "_headers")
+}
+
+// createRouter builds the route table for the files in the working
+// directory, with the rules of the _redirects file applied in front of it
+// and the rules of the _headers file applied to every response, including
+// redirects and rewrites.
+func (app App) createRouter() http.Handler {
+	headersFile := app.headersFile()
+	headerRules, err := rules.ReadHeadersFile(headersFile)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to read %v", headersFile), "error", err)
+	}
+
 	router := httptreemux.New()
 	router.PanicHandler = httptreemux.SimplePanicHandler
-	router.Use(func(next httptreemux.HandlerFunc) httptreemux.HandlerFunc {
-		return func(rw http.ResponseWriter, r *http.Request, m map[string]string) {
-			w := &loggingResponseWriter{rw, http.StatusOK}
-			requestIdentity := fmt.Sprintf("%v %v %v", r.Method, r.URL.Path, r.Proto)
-			slog.Debug(requestIdentity, "state", "request start")
-			next(w, r, m)
-			slog.Info(requestIdentity, "status", w.statusCode)
-			slog.Debug(requestIdentity, "state", "request complete")
+	var hosts *endpoints.HostLocales
+	if len(app.params.I18nHostMap) > 0 {
+		hosts = &endpoints.HostLocales{
+			Hosts:    app.params.I18nHostMap,
+			Origin:   headers.Origin{TrustForwarded: app.params.TrustForwarded},
+			Redirect: app.params.I18nHostRedirect,
 		}
-	})
+		router.Use(func(next httptreemux.HandlerFunc) httptreemux.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, m map[string]string) {
+				if location, ok := hosts.RedirectLocation(r); ok {
+					http.Redirect(w, r, location, http.StatusMovedPermanently)
+				} else {
+					next(w, r, m)
+				}
+			}
+		})
+	}
 	versionEndpoint := endpoints.VersionEndpoint(filepath.Join(app.params.WorkingDirectory, "version.json"))
 	heartbeatEndpoint := endpoints.HeartbeatEndpoint()
+	readinessEndpoint := endpoints.ReadinessEndpoint{Draining: app.draining}
 	router.GET("/__version__", versionEndpoint.Handle)
 	router.GET("/__heartbeat__", heartbeatEndpoint.Handle)
-	router.GET("/__lbheartbeat__", heartbeatEndpoint.Handle)
+	router.GET("/__lbheartbeat__", readinessEndpoint.Handle)
+
+	locales, err := app.resolveLocales()
+	if err != nil {
+		slog.Error("Failed to resolve i18n locales", "error", err)
+	}
+	for _, entry := range app.params.I18nHostMap {
+		if !slices.Contains(locales, entry.Locale) {
+			slog.Warn(fmt.Sprintf("i18n host %v is mapped to unknown locale %v (%v)", entry.Host, entry.Locale, strings.Join(locales, ", ")))
+		}
+	}
+	// The default locale can be served at unprefixed paths, in which case its
+	// files are additionally registered without the locale prefix.
+	defaultLocale := ""
+	if len(locales) > 0 && (app.params.I18nDefaultPrefix == endpoints.I18nPrefixOptional ||
+		app.params.I18nDefaultPrefix == endpoints.I18nPrefixNever) {
+		defaultLocale = endpoints.ResolveDefaultLocale(locales, app.params.I18nDefault)
+	}
+	unprefixedFiles := make(map[string]endpoints.Endpoint)
+	alternates := endpoints.ResolveLocaleAlternates(app.params.WorkingDirectory, locales, defaultLocale,
+		headers.Origin{Canonical: app.params.CanonicalOrigin, TrustForwarded: app.params.TrustForwarded}, hosts)
 
+	redirectsFile := app.redirectsFile()
+	files := make(map[string]bool)
 	indexPaths := make([]string, 0)
-	err := filepath.Walk(app.params.WorkingDirectory, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(app.params.WorkingDirectory, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
+			// Files removed while walking are simply not registered.
+			if os.IsNotExist(err) {
+				return nil
+			}
 			return err
 		}
 		if strings.HasSuffix(path, "/index.html") {
 			indexPaths = append(indexPaths, path)
-		} else if info.IsDir() || strings.HasSuffix(path, ".br") || strings.HasSuffix(path, ".gz") {
+		} else if info.IsDir() || strings.HasSuffix(path, ".br") || strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".zst") || path == redirectsFile || path == headersFile {
+			return nil
+		} else if name := filepath.Base(path); name == ".env" || strings.HasPrefix(name, ".env.") {
+			// The .env files may contain secrets and are never served.
 			return nil
 		}
 
 		requestPath, _ := filepath.Rel(app.params.WorkingDirectory, path)
-		handler, err := endpoints.ResolveFileEndpoint(path, app.params.CacheControlMaxAge)
-		if err != nil {
+		files["/"+requestPath] = true
+		handler, err := endpoints.ResolveFileEndpoint(
+			path, app.params.CacheControlMaxAge, app.assetCache, app.params.EncodingPreference)
+		// HTML files selected by the filePattern of an ngssc.json receive the
+		// variables like an index.html.
+		if appVariables := app.variables.resolveHtml(path); err == nil && app.variables.hasNgssc() &&
+			appVariables != nil && strings.HasSuffix(path, ".html") {
+			handler = endpoints.ResolveIndexEndpoint(
+				path, int(app.params.CompressionThreshold), app.params.CspTemplate, appVariables, app.params.EncodingPreference, nil)
+		}
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
 			return err
 		}
 
+		if len(defaultLocale) > 0 && strings.HasPrefix(requestPath, defaultLocale+"/") {
+			unprefixedFiles["/"+strings.TrimPrefix(requestPath, defaultLocale+"/")] = handler
+			if app.params.I18nDefaultPrefix == endpoints.I18nPrefixNever {
+				return nil
+			}
+		}
 		router.GET(fmt.Sprintf("/%v", requestPath), handler.Handle)
 		return nil
 	})
 	if err != nil {
 		slog.Error(fmt.Sprintf("Failed to walk files in %v", app.params.WorkingDirectory), "error", err)
 	}
+	for requestPath, handler := range unprefixedFiles {
+		// Files in the working directory take precedence over the files of
+		// the default locale.
+		if !files[requestPath] {
+			files[requestPath] = true
+			router.GET(requestPath, handler.Handle)
+		}
+	}
 
 	sort.Slice(indexPaths, func(i, j int) bool {
 		return len(indexPaths[i]) > len(indexPaths[j])
@@ -279,21 +934,72 @@ func (app App) createRouter() *httptreemux.TreeMux {
 		} else if !strings.HasSuffix(requestPath, "/") {
 			requestPath += "/"
 		}
+		locale := strings.TrimSuffix(requestPath, "/")
+		appVariables := app.variables.resolveHtml(path)
+		if appVariables == nil {
+			appVariables = config.DefaultAppVariables()
+		}
 		handler := endpoints.ResolveIndexEndpoint(
-			path, int(app.params.CompressionThreshold), app.params.CspTemplate, app.appVariables)
+			path, int(app.params.CompressionThreshold), app.params.CspTemplate, appVariables, app.params.EncodingPreference,
+			alternates[locale])
+		files["/"+requestPath] = true
+		if len(defaultLocale) > 0 && requestPath == defaultLocale+"/" {
+			rootHandler := endpoints.RootEndpoint{DefaultPath: defaultLocale, AvailablePaths: locales, DefaultEndpoint: handler, Hosts: hosts}
+			fallbackHandler := endpoints.FallbackEndpoint{Endpoint: rootHandler, Policy: app.params.Fallback}
+			router.GET("/", rootHandler.Handle)
+			router.GET("/*filepath", fallbackHandler.Handle)
+			files["/"] = true
+			if app.params.I18nDefaultPrefix == endpoints.I18nPrefixNever {
+				prefixHandler := endpoints.PrefixRedirectEndpoint{Prefix: defaultLocale}
+				router.GET(fmt.Sprintf("/%v", requestPath), prefixHandler.Handle)
+				router.GET(fmt.Sprintf("/%v*filepath", requestPath), prefixHandler.Handle)
+				continue
+			}
+		}
+		fallbackHandler := endpoints.FallbackEndpoint{Endpoint: handler, Policy: app.params.Fallback}
 		router.GET(fmt.Sprintf("/%v", requestPath), handler.Handle)
-		router.GET(fmt.Sprintf("/%v*filepath", requestPath), handler.Handle)
+		router.GET(fmt.Sprintf("/%v*filepath", requestPath), fallbackHandler.Handle)
 	}
 
-	if len(indexPaths) > 0 && !hasRootIndex {
-		handler := endpoints.ResolveRootEndpoint(app.params.WorkingDirectory, app.params.I18nDefault)
+	if len(locales) > 0 && len(defaultLocale) == 0 && !hasRootIndex {
+		handler := endpoints.ResolveRootEndpoint(locales, app.params.I18nDefault, hosts)
+		fallbackHandler := endpoints.FallbackEndpoint{Endpoint: handler, Policy: app.params.Fallback}
 		router.GET("/", handler.Handle)
-		router.GET("/*filepath", handler.Handle)
+		router.GET("/*filepath", fallbackHandler.Handle)
 	}
 
-	return router
+	redirects, err := rules.ReadRedirectsFile(redirectsFile)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to read %v", redirectsFile), "error", err)
+	}
+	var handler http.Handler = router
+	if len(redirects) > 0 {
+		handler = rules.RedirectHandler{
+			Redirects: redirects,
+			Next:      router,
+			Exists: func(path string) bool {
+				return files[path]
+			},
+		}
+	}
+
+	return logRequests(handler, headerRules)
+}
+
+// logRequests logs every request and applies the rules of the _headers file
+// for the requested path, which includes redirected and rewritten requests.
+func logRequests(next http.Handler, headerRules rules.HeaderRules) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := &loggingResponseWriter{rw, http.StatusOK}
+		requestIdentity := fmt.Sprintf("%v %v %v", r.Method, r.URL.Path, r.Proto)
+		slog.Debug(requestIdentity, "state", "request start")
+		next.ServeHTTP(headerRules.Wrap(w, r.URL.Path), r)
+		slog.Info(requestIdentity, "status", w.statusCode)
+		slog.Debug(requestIdentity, "state", "request complete")
+	})
 }
 
 func (app *App) Close() {
+	app.treeWatcher.Close()
 	app.fileWatcher.Close()
 }
@@ -2,18 +2,28 @@ package serve
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"ngstaticserver/constants"
+	"ngstaticserver/serve/config"
+	"ngstaticserver/serve/endpoints"
+	"ngstaticserver/serve/headers"
 	"ngstaticserver/test"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/net/http2"
 )
 
 var Licenses = "3rdpartylicenses.txt"
@@ -64,7 +74,13 @@ func TestFileRequest(t *testing.T) {
 
 func TestFileRequestBrotli(t *testing.T) {
 	for _, e := range []string{"*", "br", "gz, deflate, br"} {
-		app, context := createTestApp(t)
+		app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+			context.ImportTestApp("ngssc")
+			// zstd is preferred by default, if the client accepts any encoding
+			if e == "*" {
+				params.EncodingPreference = []headers.Encoding{headers.BROTLI, headers.GZIP}
+			}
+		})
 		polyfill := context.FindFile("polyfills.")
 		context.CompressFile(polyfill)
 		content := context.ReadFile(polyfill)
@@ -85,12 +101,56 @@ func TestFileRequestBrotli(t *testing.T) {
 	}
 }
 
+func TestFileRequestZstd(t *testing.T) {
+	for _, e := range []string{"*", "zstd", "gzip, deflate, br, zstd"} {
+		app, context := createTestApp(t)
+		polyfill := context.FindFile("polyfills.")
+		context.CompressFile(polyfill)
+		content := context.ReadFile(polyfill)
+
+		req := httptest.NewRequest("GET", fmt.Sprintf("/%v", polyfill), nil)
+		req.Header.Add("Accept-Encoding", e)
+		w := httptest.NewRecorder()
+		app.createRouter().ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := io.ReadAll(resp.Body)
+
+		test.AssertEqual(t, resp.StatusCode, 200)
+		test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "zstd")
+		responseContent := string(test.DecompressZstd(body))
+		test.AssertEqual(t, responseContent, content)
+	}
+}
+
+func TestFileRequestEncodingPreference(t *testing.T) {
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("ngssc")
+		params.EncodingPreference = []headers.Encoding{headers.BROTLI, headers.ZSTD, headers.GZIP}
+	})
+	polyfill := context.FindFile("polyfills.")
+	context.CompressFile(polyfill)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", polyfill), nil)
+	req.Header.Add("Accept-Encoding", "gzip, deflate, br, zstd")
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	resp := w.Result()
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "br")
+}
+
 func TestIndexRequestBrotli(t *testing.T) {
 	for _, s := range []bool{false, true} {
-		for _, e := range []string{"*", "br"} {
+		for _, e := range []string{"*", "br", "gzip, br"} {
 			app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
 				context.ImportTestApp("ngssc")
 				params.CompressionThreshold = 10
+				// zstd is preferred by default, if the client accepts any encoding
+				if e == "*" {
+					params.EncodingPreference = []headers.Encoding{headers.BROTLI, headers.GZIP}
+				}
 				context.CompressFile(IndexHtml)
 				if s {
 					context.RemoveFile("ngssc.json")
@@ -124,6 +184,27 @@ func TestIndexRequestBrotli(t *testing.T) {
 	}
 }
 
+func TestIndexRequestZstd(t *testing.T) {
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("ngssc")
+		params.CompressionThreshold = 10
+	})
+	content := context.ReadFile(IndexHtml)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Encoding", "*")
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("Content-Encoding"), "zstd")
+	responseContent := string(test.DecompressZstd(body))
+	test.AssertTrue(t, strings.HasPrefix(responseContent, content[:strings.Index(content, "<!--CONFIG-->")]))
+}
+
 func TestFileRequestGzip(t *testing.T) {
 	app, context := createTestApp(t)
 	polyfill := context.FindFile("polyfills.")
@@ -255,7 +336,7 @@ func TestNonGetRequest(t *testing.T) {
 func TestHeadRequest(t *testing.T) {
 	app, _ := createTestApp(t)
 
-	req := httptest.NewRequest("HEAD", "/example.txt", nil)
+	req := httptest.NewRequest("HEAD", "/example", nil)
 	w := httptest.NewRecorder()
 	app.createRouter().ServeHTTP(w, req)
 
@@ -267,6 +348,124 @@ func TestHeadRequest(t *testing.T) {
 	test.AssertEqual(t, string(body), "")
 }
 
+func TestMissingAssetNotFound(t *testing.T) {
+	app, _ := createTestApp(t)
+
+	for _, path := range []string{"/chunk-ABC123.js", "/assets/logo.png", "/de-CH/missing.css"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		app.createRouter().ServeHTTP(w, req)
+
+		test.AssertEqual(t, w.Result().StatusCode, 404)
+	}
+}
+
+func TestFallbackNavigationWithExtension(t *testing.T) {
+	app, _ := createTestApp(t)
+
+	req := httptest.NewRequest("GET", "/users/john.doe", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.Header.Get("Content-Type"), "text/html; charset=utf-8")
+}
+
+func TestFallbackStrict(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("ngssc")
+		params.Fallback.Mode = endpoints.FallbackStrict
+	})
+
+	req := httptest.NewRequest("GET", "/example", nil)
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 404)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+}
+
+func TestRedirectsFile(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		context.WriteFile("_redirects", "/blog/:slug /news/:slug 301\n/licenses /3rdpartylicenses.txt 200\n/index.html /moved 302")
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/blog/hello?ref=mail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusMovedPermanently)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/news/hello?ref=mail")
+
+	req = httptest.NewRequest("GET", "/licenses", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+	test.AssertEqual(t, w.Result().Header.Get("Content-Type"), "text/plain; charset=utf-8")
+
+	// Existing files shadow rules which are not forced
+	req = httptest.NewRequest("GET", "/index.html", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+
+	req = httptest.NewRequest("GET", "/_redirects", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	body, _ := io.ReadAll(w.Result().Body)
+	test.AssertTrue(t, !strings.Contains(string(body), "/news/:slug"))
+}
+
+func TestHeadersFile(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		context.WriteFile("_headers", "/*\n  X-Robots-Tag: noindex\n/*.txt\n  Cache-Control: max-age=60")
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", Licenses), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+	test.AssertEqual(t, w.Result().Header.Get("X-Robots-Tag"), "noindex")
+	test.AssertEqual(t, w.Result().Header.Get("Cache-Control"), "max-age=60")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().Header.Get("X-Robots-Tag"), "noindex")
+	test.AssertEqual(t, w.Result().Header.Get("Cache-Control"), "no-cache")
+}
+
+func TestHeadersFileWithRedirects(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		context.WriteFile("_redirects", "/blog/:slug /news/:slug 301\n/licenses /3rdpartylicenses.txt 200")
+		context.WriteFile("_headers", "/blog/*\n  X-Robots-Tag: noindex\n/licenses\n  X-Requested: licenses\n/*.txt\n  X-Requested: txt")
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/blog/hello", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusMovedPermanently)
+	test.AssertEqual(t, w.Result().Header.Get("X-Robots-Tag"), "noindex")
+
+	// Rules of the requested path apply to rewrites
+	req = httptest.NewRequest("GET", "/licenses", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+	test.AssertEqual(t, w.Result().Header.Get("X-Requested"), "licenses")
+}
+
 func TestLanguageRedirect(t *testing.T) {
 	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
 		context.ImportTestApp("i18n")
@@ -282,6 +481,629 @@ func TestLanguageRedirect(t *testing.T) {
 	test.AssertEqual(t, resp.Header.Get("Location"), "/de-CH")
 }
 
+func TestLanguageRedirectPreservesPath(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+	})
+
+	req := httptest.NewRequest("GET", "/products/42?ref=mail", nil)
+	req.Header.Add("Accept-Language", "fr-CH, en;q=0.8")
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, http.StatusTemporaryRedirect)
+	test.AssertEqual(t, resp.Header.Get("Location"), "/fr/products/42?ref=mail")
+	test.AssertEqual(t, resp.Header.Get("Vary"), "Accept-Language, Cookie")
+}
+
+func TestDefaultLocaleUnprefixed(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		params.I18nDefault = "de-CH"
+		params.I18nDefaultPrefix = endpoints.I18nPrefixOptional
+	})
+	router := app.createRouter()
+
+	for _, path := range []string{"/", "/products/42", "/de-CH/", "/de-CH/products/42"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Add("Accept-Language", "fr")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		test.AssertEqual(t, w.Result().StatusCode, http.StatusOK)
+		test.AssertTrue(t, strings.Contains(w.Body.String(), `lang="de-CH"`))
+	}
+
+	req := httptest.NewRequest("GET", "/favicon.ico", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusOK)
+
+	req = httptest.NewRequest("GET", "/fr/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusOK)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `lang="fr"`))
+}
+
+func TestDefaultLocalePrefixRedirect(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		params.I18nDefault = "de-CH"
+		params.I18nDefaultPrefix = endpoints.I18nPrefixNever
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/de-CH/products/42?ref=mail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusMovedPermanently)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/products/42?ref=mail")
+
+	req = httptest.NewRequest("GET", "/favicon.ico", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusOK)
+
+	req = httptest.NewRequest("GET", "/products/42?lang=fr", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusTemporaryRedirect)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/fr/products/42")
+}
+
+func TestLocaleAlternateLinks(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		params.TrustForwarded = true
+	})
+
+	req := httptest.NewRequest("GET", "/en-US/products/42", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "example.com")
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, http.StatusOK)
+	test.AssertEqual(t, resp.Header.Get("Content-Language"), "en-US")
+	test.AssertTrue(t, strings.Contains(
+		resp.Header.Get("Link"), `<https://example.com/fr/products/42>; rel="alternate"; hreflang="fr"`))
+	test.AssertTrue(t, strings.Contains(
+		resp.Header.Get("Link"), `<https://example.com/products/42>; rel="alternate"; hreflang="x-default"`))
+}
+
+func TestI18nHostMap(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		params.I18nHostMap = []endpoints.HostLocale{{Host: "example.ch", Locale: "de-CH"}, {Host: "example.fr", Locale: "fr"}}
+		params.I18nHostRedirect = true
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/products/42", nil)
+	req.Host = "example.fr"
+	req.Header.Add("Accept-Language", "de-CH")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusTemporaryRedirect)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/fr/products/42")
+
+	req = httptest.NewRequest("GET", "/fr/products/42?ref=mail", nil)
+	req.Host = "example.ch"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusMovedPermanently)
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "http://example.fr/fr/products/42?ref=mail")
+
+	req = httptest.NewRequest("GET", "/fr/products/42", nil)
+	req.Host = "example.fr"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusOK)
+	test.AssertTrue(t, strings.Contains(
+		w.Result().Header.Get("Link"), `<http://example.ch/de-CH/products/42>; rel="alternate"; hreflang="de-CH"`))
+}
+
+func TestLocaleVariables(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "PHONE=+41 00 000 00 00\nREGION=eu")
+		context.WriteFile(".env.fr", "PHONE=+33 0 00 00 00 00")
+		params.PublicVariables = config.PublicVariables{Names: []string{"PHONE", "REGION"}}
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/fr/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `{"PHONE":"+33 0 00 00 00 00","REGION":"eu"}`))
+
+	req = httptest.NewRequest("GET", "/de-CH/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `{"PHONE":"+41 00 000 00 00","REGION":"eu"}`))
+}
+
+func TestPublicVariables(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "NG_PUBLIC_API=api\nREGION=eu\nDB_PASSWORD=secret")
+		params.PublicVariables = config.PublicVariables{Prefix: "NG_PUBLIC_", Names: []string{"REGION"}}
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/fr/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `{"NG_PUBLIC_API":"api","REGION":"eu"}`))
+	test.AssertTrue(t, !strings.Contains(w.Body.String(), "secret"))
+}
+
+func TestPublicVariables_skipped(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "NG_PUBLIC_API=api\nDB_PASSWORD=secret")
+		context.WriteFile(".env.fr", "NG_PUBLIC_REGION=fr\nFR_TOKEN=secret")
+		params.PublicVariables = config.PublicVariables{Prefix: "NG_PUBLIC_"}
+	})
+
+	test.AssertEqual(t, strings.Join(app.variables.skippedVariables(), ","), "DB_PASSWORD,FR_TOKEN")
+}
+
+func TestPublicVariables_withoutPolicy(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "NG_PUBLIC_API=api\nDB_PASSWORD=secret")
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/fr/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertEqual(t, w.Result().StatusCode, 200)
+	test.AssertTrue(t, !strings.Contains(w.Body.String(), "NG_PUBLIC_API"))
+	test.AssertTrue(t, !strings.Contains(w.Body.String(), "secret"))
+}
+
+func TestDotEnvNotServed(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		context.WriteFile(".env", "DB_PASSWORD=secret")
+		context.WriteFile(".env.local", "DB_PASSWORD=secret")
+		context.WriteFile(".env.fr", "DB_PASSWORD=secret")
+		params.Fallback = endpoints.FallbackPolicy{Mode: endpoints.FallbackStrict}
+	})
+	router := app.createRouter()
+
+	for _, path := range []string{"/.env", "/.env.local", "/.env.fr"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		test.AssertEqual(t, w.Result().StatusCode, http.StatusNotFound)
+		test.AssertTrue(t, !strings.Contains(w.Body.String(), "secret"))
+	}
+}
+
+func TestLayeredDotEnv(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "HOST=example.com\nAPI_URL=https://${HOST}/api")
+		context.WriteFile(".env.production", "HOST=example.ch")
+		params.AppEnv = "production"
+		params.PublicVariables = config.PublicVariables{Names: []string{"API_URL", "HOST"}}
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/fr/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `{"API_URL":"https://example.ch/api","HOST":"example.ch"}`))
+}
+
+func TestConfigDir(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "LABEL=label\nREGION=eu")
+		params.ConfigDir = t.TempDir()
+		test.AssertNoError(t, os.WriteFile(filepath.Join(params.ConfigDir, "LABEL"), []byte("mounted\n"), 0644))
+		params.PublicVariables = config.PublicVariables{Names: []string{"LABEL", "REGION"}}
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/fr/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `{"LABEL":"mounted","REGION":"eu"}`))
+}
+
+func TestConfigDir_withoutPolicy(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	configDir := t.TempDir()
+	test.AssertNoError(t, os.WriteFile(filepath.Join(configDir, "DB_PASSWORD"), []byte("secret"), 0644))
+	params := &ServerParams{WorkingDirectory: context.Path, ConfigDir: configDir}
+
+	_, err := createApp(params)
+	test.AssertTrue(t, err != nil)
+
+	context.WriteFile("ngssc.json", `{"variant":"global","environmentVariables":["LABEL"]}`)
+	app, err := createApp(params)
+	test.AssertNoError(t, err)
+	app.Close()
+}
+
+func TestMultipleNgsscJson(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "LABEL=label")
+		context.WriteFile("ngssc.json", `{"variant":"global","environmentVariables":["LABEL"]}`)
+		context.WriteFile("fr/ngssc.json", `{"variant":"NG_ENV","environmentVariables":["LABEL"]}`)
+	})
+	router := app.createRouter()
+
+	req := httptest.NewRequest("GET", "/de-CH/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `Object.assign(self,{"LABEL":"label"})`))
+
+	req = httptest.NewRequest("GET", "/fr/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	test.AssertTrue(t, strings.Contains(w.Body.String(), `self.NG_ENV={"LABEL":"label"}`))
+}
+
+func TestNgsscFilePattern(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "LABEL=label")
+		context.WriteFile("ngssc.json", `{"variant":"global","environmentVariables":["LABEL"],"filePattern":"*/*.html"}`)
+		context.WriteFile("fr/ngssc.json", `{"variant":"global","environmentVariables":["LABEL"],"filePattern":"other.html"}`)
+		test.AssertNoError(t, os.MkdirAll(filepath.Join(context.Path, "static"), 0755))
+		context.WriteFile("static/page.html", "<html><head><title>Page</title></head></html>")
+	})
+	router := app.createRouter()
+
+	for path, injected := range map[string]bool{"/de-CH/": true, "/static/page.html": true, "/fr/": false} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		test.AssertEqual(t, w.Result().StatusCode, http.StatusOK)
+		test.AssertEqual(t, strings.Contains(w.Body.String(), `{"LABEL":"label"}`), injected)
+	}
+}
+
+func TestInvalidNgsscJson(t *testing.T) {
+	context := test.NewTestDir(t)
+	context.ImportTestApp("i18n")
+	context.WriteFile("fr/ngssc.json", `{"variant":"env","environmentVariables":[]}`)
+
+	_, err := createApp(&ServerParams{WorkingDirectory: context.Path})
+	test.AssertTrue(t, err != nil && strings.Contains(err.Error(), "variant must either be process, NG_ENV or global"))
+}
+
+func TestLanguageRedirectIgnoresAssets(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		test.AssertNoError(t, os.MkdirAll(filepath.Join(context.Path, "assets"), 0755))
+		context.WriteFile("assets/index.html", "<html><body>Not a locale</body></html>")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Accept-Language", "as")
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	test.AssertEqual(t, w.Result().Header.Get("Location"), "/de-CH")
+}
+
+func TestMissingIndex(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		test.AssertNoError(t, os.MkdirAll(filepath.Join(context.Path, "assets"), 0755))
+		context.WriteFile("assets/logo.svg", "<svg></svg>")
+	})
+
+	_, err := app.resolveLocales()
+	test.AssertTrue(t, err != nil)
+}
+
+func TestMissingLocales(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		params.I18nLocales = []string{"de-CH", "it"}
+	})
+
+	_, err := app.resolveLocales()
+	test.AssertTrue(t, err != nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	app.createRouter().ServeHTTP(w, req)
+
+	test.AssertEqual(t, w.Result().StatusCode, http.StatusNotFound)
+}
+
+func TestLiveRouterRebuild(t *testing.T) {
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		params.WatchDebounce = time.Millisecond * 10
+	})
+	router := app.createLiveRouter()
+
+	context.WriteFile("added.txt", "added")
+	awaitStatus(t, router, "/added.txt", 200)
+
+	context.RemoveFile("added.txt")
+	awaitStatus(t, router, "/added.txt", 404)
+}
+
+func TestNgsscJsonHotReload(t *testing.T) {
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("ngssc")
+		context.WriteFile(".env", "LABEL=label")
+		params.WatchDebounce = time.Millisecond * 10
+	})
+	router := app.createLiveRouter()
+	awaitBody(t, router, "/", `self.process={"env":{"LABEL":"label"`)
+
+	context.WriteFile("ngssc.json", `{"variant":"NG_ENV","environmentVariables":["LABEL","NGSS_CSP_NONCE"]}`)
+	awaitBody(t, router, "/", `self.NG_ENV={"LABEL":"label"`)
+
+	// An invalid ngssc.json keeps the previous configuration.
+	context.WriteFile("ngssc.json", `{"variant":"env"}`)
+	time.Sleep(time.Millisecond * 50)
+	awaitBody(t, router, "/", `self.NG_ENV={"LABEL":"label"`)
+}
+
+func TestNgsscJsonAddedAfterStartup(t *testing.T) {
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("i18n")
+		context.WriteFile(".env", "LABEL=label")
+		params.WatchDebounce = time.Millisecond * 10
+	})
+	router := app.createLiveRouter()
+
+	context.WriteFile("fr/ngssc.json", `{"variant":"NG_ENV","environmentVariables":["LABEL"]}`)
+	awaitBody(t, router, "/fr/", `self.NG_ENV={"LABEL":"label"}`)
+
+	// The added ngssc.json is watched after the reload.
+	context.WriteFile("fr/ngssc.json", `{"variant":"global","environmentVariables":["LABEL"]}`)
+	awaitBody(t, router, "/fr/", `Object.assign(self,{"LABEL":"label"})`)
+}
+
+func TestIndexHtmlHotReload(t *testing.T) {
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("ngssc")
+		context.WriteFile("index.html", "<html><head><title>App</title><script>var a=1;</script></head></html>")
+		params.WatchDebounce = time.Millisecond * 10
+	})
+	router := app.createLiveRouter()
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	csp := w.Result().Header.Get("Content-Security-Policy")
+	test.AssertTrue(t, strings.Contains(csp, "'sha512-"))
+
+	context.WriteFile("index.html", "<html><head><title>App</title><script>var a=2;</script></head></html>")
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if changed := w.Result().Header.Get("Content-Security-Policy"); changed != csp {
+			test.AssertTrue(t, strings.Contains(w.Body.String(), "var a=2;"))
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("CSP of / was not updated (got %v)", changed)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestRemovedFileBeforeRebuild(t *testing.T) {
+	app, context := createTestApp(t)
+	router := app.createRouter()
+	context.RemoveFile(Licenses)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/%v", Licenses), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+
+	test.AssertEqual(t, resp.StatusCode, 404)
+}
+
+func TestTlsServer(t *testing.T) {
+	var certificate *x509.Certificate
+	app, context := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		certificate = context.WriteCertificate("../config/tls.crt", "../config/tls.key", "localhost")
+		params.TlsCert = context.Join("../config/tls.crt")
+		params.TlsKey = context.Join("../config/tls.key")
+	})
+	content := context.ReadFile(Licenses)
+	server, err := app.createServer(app.createRouter())
+	test.AssertNoError(t, err)
+	ts := httptest.NewUnstartedServer(server.Handler)
+	ts.TLS = server.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(certificate)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: rootCAs},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get(fmt.Sprintf("%v/%v", ts.URL, Licenses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.ProtoMajor, 2)
+	test.AssertEqual(t, string(body), content)
+}
+
+func TestTlsServerRequiresClientCertificate(t *testing.T) {
+	var certificate *x509.Certificate
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		certificate = context.WriteCertificate("../config/tls.crt", "../config/tls.key", "localhost")
+		context.WriteCertificate("../config/ca.crt", "../config/ca.key", "ca")
+		params.TlsCert = context.Join("../config/tls.crt")
+		params.TlsKey = context.Join("../config/tls.key")
+		params.TlsClientCa = context.Join("../config/ca.crt")
+	})
+	server, err := app.createServer(app.createRouter())
+	test.AssertNoError(t, err)
+	ts := httptest.NewUnstartedServer(server.Handler)
+	ts.TLS = server.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(certificate)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	_, err = client.Get(ts.URL)
+	test.AssertTrue(t, err != nil)
+}
+
+func TestH2cServer(t *testing.T) {
+	app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+		context.ImportTestApp("minimal")
+		params.H2c = true
+	})
+	server, err := app.createServer(app.createRouter())
+	test.AssertNoError(t, err)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp, err := client.Get(fmt.Sprintf("%v/%v", ts.URL, Licenses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	test.AssertEqual(t, resp.StatusCode, 200)
+	test.AssertEqual(t, resp.ProtoMajor, 2)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	for _, h2c := range []bool{false, true} {
+		t.Run(fmt.Sprintf("h2c=%v", h2c), func(t *testing.T) {
+			app, _ := createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
+				context.ImportTestApp("minimal")
+				params.ShutdownDelay = time.Millisecond * 100
+				params.ShutdownTimeout = time.Second
+				params.H2c = h2c
+			})
+			router := app.createRouter()
+			slowCompleted := &atomic.Bool{}
+			server, err := app.createServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					time.Sleep(time.Millisecond * 200)
+					defer slowCompleted.Store(true)
+				}
+				router.ServeHTTP(w, r)
+			}))
+			test.AssertNoError(t, err)
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			test.AssertNoError(t, err)
+			go serveHTTP(server, listener)
+			url := fmt.Sprintf("http://%v", listener.Addr())
+
+			client := http.DefaultClient
+			if h2c {
+				client = &http.Client{Transport: &http2.Transport{
+					AllowHTTP: true,
+					DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+						return net.Dial(network, addr)
+					},
+				}}
+			}
+			slowStatus := make(chan int, 1)
+			go func() {
+				resp, err := client.Get(url + "/slow")
+				if err != nil {
+					slowStatus <- 0
+					return
+				}
+				resp.Body.Close()
+				if h2c && resp.ProtoMajor != 2 {
+					slowStatus <- -1
+					return
+				}
+				slowStatus <- resp.StatusCode
+			}()
+			time.Sleep(time.Millisecond * 20)
+
+			shutdownComplete := make(chan bool, 1)
+			go func() {
+				app.shutdown(server)
+				shutdownComplete <- true
+			}()
+			time.Sleep(time.Millisecond * 20)
+
+			resp, err := http.Get(url + "/__lbheartbeat__")
+			test.AssertNoError(t, err)
+			resp.Body.Close()
+			test.AssertEqual(t, resp.StatusCode, 503)
+			resp, err = http.Get(url + "/__heartbeat__")
+			test.AssertNoError(t, err)
+			resp.Body.Close()
+			test.AssertEqual(t, resp.StatusCode, 200)
+
+			<-shutdownComplete
+			test.AssertTrue(t, slowCompleted.Load())
+			test.AssertEqual(t, <-slowStatus, 200)
+			_, err = http.Get(url + "/__heartbeat__")
+			test.AssertTrue(t, err != nil)
+		})
+	}
+}
+
+func awaitStatus(t *testing.T, router http.Handler, path string, status int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Result().StatusCode == status {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("%v did not respond with %v (got %v)", path, status, w.Result().StatusCode)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func awaitBody(t *testing.T, router http.Handler, path string, content string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if strings.Contains(w.Body.String(), content) {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("%v did not contain %v", path, content)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
 func createTestApp(t *testing.T) (App, test.TestDir) {
 	return createTestAppWithInit(t, func(context test.TestDir, params *ServerParams) {
 		context.ImportTestApp("ngssc")
@@ -296,12 +1118,15 @@ func createTestAppWithInit(t *testing.T, init func(context test.TestDir, params
 		Port:                 0,
 		CacheControlMaxAge:   31536000,
 		CompressionThreshold: constants.DefaultCompressionThreshold,
+		CacheSize:            constants.DefaultCacheSize,
+		CacheMaxFileSize:     constants.DefaultCacheMaxFileSize,
 		LogLevel:             "ERROR",
 		CspTemplate:          cspTemplate,
 		XFrameOptions:        "DENY",
 	}
 	init(context, params)
-	app := createApp(params)
+	app, err := createApp(params)
+	test.AssertNoError(t, err)
 	t.Cleanup(func() {
 		app.Close()
 	})
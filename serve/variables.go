@@ -0,0 +1,189 @@
+package serve
+
+import (
+	"io/fs"
+	"ngstaticserver/serve/config"
+	"ngstaticserver/serve/endpoints"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// variableSet contains the app variables of the .env file, of every
+// ngssc.json and of each locale of an i18n build. The ngssc.json files are
+// read again on reload, so that changes are applied without a restart.
+type variableSet struct {
+	mutex            sync.RWMutex
+	workingDirectory string
+	// dotEnv contains the variables of the .env file, if there is no ngssc.json.
+	dotEnv *config.AppVariables
+	// ngssc contains the app variables of every ngssc.json.
+	ngssc []*config.AppVariables
+	// locales contains the app variables of each locale of an i18n build.
+	locales map[string]*config.LocaleVariables
+	// global contains the current variables of the .env file and the config directory.
+	global map[string]*string
+}
+
+func newVariableSet(params *ServerParams, locales []string) (*variableSet, error) {
+	ngssc, err := config.DiscoverAppVariables(params.WorkingDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	dotEnv := config.DefaultAppVariables()
+	dotEnv.Public = &params.PublicVariables
+	set := &variableSet{
+		workingDirectory: params.WorkingDirectory,
+		dotEnv:           dotEnv,
+		ngssc:            ngssc,
+		locales:          make(map[string]*config.LocaleVariables),
+	}
+	for _, locale := range locales {
+		set.locales[locale] = config.NewLocaleVariables(locale, set.resolve(set.localeIndex(locale)))
+	}
+	return set, nil
+}
+
+// mergeGlobal is called with the variables of the .env file and the config
+// directory.
+func (set *variableSet) mergeGlobal(variables map[string]*string) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.global = variables
+	set.dotEnv.MergeVariables(variables)
+	for _, appVariables := range set.ngssc {
+		appVariables.MergeVariables(variables)
+	}
+	for _, localeVariables := range set.locales {
+		localeVariables.MergeGlobal(variables)
+	}
+}
+
+// reload reads the ngssc.json files again. The app variables of unchanged
+// ngssc.json files are kept. On error, the previous configuration is kept.
+func (set *variableSet) reload() error {
+	ngssc, err := config.DiscoverAppVariables(set.workingDirectory)
+	if err != nil {
+		return err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	for i, appVariables := range ngssc {
+		if previous := set.find(appVariables.Dir); previous != nil && previous.HasSameConfiguration(appVariables) {
+			ngssc[i] = previous
+		} else {
+			appVariables.MergeVariables(set.global)
+		}
+	}
+	set.ngssc = ngssc
+	for locale, localeVariables := range set.locales {
+		localeVariables.Rebase(set.resolve(set.localeIndex(locale)))
+	}
+	return nil
+}
+
+// skippedVariables returns the sorted names of the variables of the .env
+// files, the config directory and the .env.<locale> overlays, which are not
+// public. Without an ngssc.json, these are not inserted into the HTML files.
+func (set *variableSet) skippedVariables() []string {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	variables := make(map[string]*string, len(set.global))
+	for name, value := range set.global {
+		variables[name] = value
+	}
+	for _, localeVariables := range set.locales {
+		for name, value := range localeVariables.Overlay() {
+			variables[name] = value
+		}
+	}
+	_, skipped := set.dotEnv.Public.Filter(variables)
+	return skipped
+}
+
+func (set *variableSet) find(dir string) *config.AppVariables {
+	for _, appVariables := range set.ngssc {
+		if appVariables.Dir == dir {
+			return appVariables
+		}
+	}
+
+	return nil
+}
+
+func (set *variableSet) hasNgssc() bool {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	return len(set.ngssc) > 0
+}
+
+// ngsscFiles returns the paths of the ngssc.json files.
+func (set *variableSet) ngsscFiles() []string {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	files := make([]string, 0, len(set.ngssc))
+	for _, appVariables := range set.ngssc {
+		files = append(files, filepath.Join(appVariables.Dir, "ngssc.json"))
+	}
+	return files
+}
+
+// ngsscAddedOrRemoved returns whether the ngssc.json files in the working
+// directory differ from the ngssc.json files read by the last (re)load.
+func (set *variableSet) ngsscAddedOrRemoved() bool {
+	files := make([]string, 0)
+	filepath.WalkDir(set.workingDirectory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && entry.Name() == "ngssc.json" {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+
+	return !slices.Equal(files, set.ngsscFiles())
+}
+
+func (set *variableSet) localeIndex(locale string) string {
+	return filepath.Join(set.workingDirectory, locale, "index.html")
+}
+
+// resolveHtml returns the app variables of the locale for the index.html of
+// a locale, or the app variables resolved by the ngssc.json files otherwise.
+func (set *variableSet) resolveHtml(filePath string) *config.AppVariables {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	relativePath, _ := filepath.Rel(set.workingDirectory, filePath)
+	if localeVariables, ok := set.locales[filepath.Dir(relativePath)]; ok && filepath.Base(relativePath) == "index.html" {
+		return localeVariables.AppVariables
+	}
+
+	return set.resolve(filePath)
+}
+
+// resolve returns the app variables of the nearest ngssc.json, if its
+// filePattern matches the HTML file, or nil otherwise. Without any
+// ngssc.json, the variables of the .env file are used.
+func (set *variableSet) resolve(filePath string) *config.AppVariables {
+	if len(set.ngssc) == 0 {
+		return set.dotEnv
+	}
+
+	var result *config.AppVariables
+	relativePath := ""
+	for _, appVariables := range set.ngssc {
+		path, err := filepath.Rel(appVariables.Dir, filePath)
+		if err != nil || path == ".." || strings.HasPrefix(path, "../") {
+			continue
+		} else if result == nil || len(appVariables.Dir) > len(result.Dir) {
+			result = appVariables
+			relativePath = path
+		}
+	}
+	if result == nil || !endpoints.GlobToRegexp(result.FilePattern).MatchString(filepath.ToSlash(relativePath)) {
+		return nil
+	}
+
+	return result
+}
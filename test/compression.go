@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 func DecompressBrotliFile(filePath string) []byte {
@@ -43,6 +44,28 @@ func DecompressGzip(content []byte) []byte {
 	return buf.Bytes()
 }
 
+func DecompressZstdFile(filePath string) []byte {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		panic(err)
+	}
+
+	return DecompressZstd(content)
+}
+
+func DecompressZstd(content []byte) []byte {
+	zstdReader, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+	defer zstdReader.Close()
+	result, err := zstdReader.DecodeAll(content, nil)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
 func CompressToFile(content []byte, file string) {
 	compressedContent := compress(content, func(buffer *bytes.Buffer) io.WriteCloser {
 		return brotli.NewWriterLevel(buffer, brotli.BestCompression)
@@ -59,6 +82,14 @@ func CompressToFile(content []byte, file string) {
 	if err != nil {
 		panic(err)
 	}
+	compressedContent = compress(content, func(buffer *bytes.Buffer) io.WriteCloser {
+		writer, _ := zstd.NewWriter(buffer, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		return writer
+	})
+	err = os.WriteFile(file+".zst", compressedContent, 0644)
+	if err != nil {
+		panic(err)
+	}
 }
 
 func compress(content []byte, compression func(buffer *bytes.Buffer) io.WriteCloser) []byte {